@@ -8,12 +8,15 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/c0sm0thecoder/cli-chat-app/internal/controllers"
+	"github.com/c0sm0thecoder/cli-chat-app/internal/jwtkeys"
 	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"github.com/c0sm0thecoder/cli-chat-app/internal/notify"
 	"github.com/c0sm0thecoder/cli-chat-app/internal/realtime"
 	"github.com/c0sm0thecoder/cli-chat-app/internal/repositories"
 	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
@@ -43,12 +46,6 @@ func main() {
 		log.Println("Warning: No .env file found. Using environment variables.")
 	}
 
-	// Set default JWT secret if not provided
-	if os.Getenv("JWT_SECRET") == "" {
-		log.Println("Warning: JWT_SECRET not set. Using default value for development.")
-		os.Setenv("JWT_SECRET", "your-secret-key-replace-in-production")
-	}
-
 	// If CLI mode is enabled, start the CLI interface
 	if cliMode {
 		if serverURL == "" {
@@ -69,20 +66,71 @@ func main() {
 	userRepo := repositories.NewUserRepository(db)
 	roomRepo := repositories.NewRoomRepository(db)
 	messageRepo := repositories.NewMessageRepository(db)
+	reactionRepo := repositories.NewReactionRepository(db)
+	mentionRepo := repositories.NewMentionRepository(db)
+	receiptRepo := repositories.NewReadReceiptRepository(db)
+	memberRepo := repositories.NewRoomMemberRepository(db)
+	inviteRepo := repositories.NewInviteRepository(db)
+	refreshTokenRepo := repositories.NewRefreshTokenRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	resetRepo := repositories.NewPasswordResetRepository(db)
+	twoFactorRepo := repositories.NewTwoFactorRepository(db)
+
+	// Load the keys access tokens are signed and verified with
+	keys, err := setupSigningKeys()
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	stopReloading := make(chan struct{})
+	go keys.ReloadEvery(jwtkeys.ReloadInterval, stopReloading)
+
+	// Share broadcasts between server replicas when Redis is configured
+	broker := realtime.NewLocalBroker()
+	if os.Getenv("REDIS_URL") != "" {
+		redisClient, err := realtime.GetRedisClient()
+		if err != nil {
+			log.Fatalf("Failed to create Redis client: %v", err)
+		}
+		broker, err = realtime.NewRedisBroker(redisClient)
+		if err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		log.Println("Broadcasting room events through Redis")
+	}
+	hub := realtime.NewHub(broker, keys, realtime.HubConfig{
+		SendQueueSize: envInt("WS_SEND_QUEUE_SIZE"),
+		WriteTimeout:  time.Duration(envInt("WS_WRITE_TIMEOUT_SECONDS")) * time.Second,
+	})
+
+	// Deliver password reset tokens to a file when one is configured, to the log otherwise
+	var notifier notify.Notifier = notify.NewLogNotifier()
+	if path := os.Getenv("NOTIFY_FILE"); path != "" {
+		notifier = notify.NewFileNotifier(path)
+	}
 
 	// Initialize services
-	authService := services.NewAuthService(userRepo, os.Getenv("JWT_SECRET"))
-	chatService := services.NewChatService(roomRepo, messageRepo, userRepo)
+	moderators := parseList(os.Getenv("CHAT_MODERATORS"))
+	admins := parseList(os.Getenv("CHAT_ADMINS"))
+	authService := services.NewAuthService(userRepo, refreshTokenRepo, sessionRepo, resetRepo, twoFactorRepo, hub, keys, notifier, admins)
+	chatService := services.NewChatService(roomRepo, messageRepo, userRepo, reactionRepo, mentionRepo, receiptRepo, memberRepo, inviteRepo, hub, moderators)
 
 	// Start the HTTP server
 	router := chi.NewRouter()
 
 	// API routes
-	apiRouter := controllers.NewV1Router(authService, chatService)
+	apiRouter := controllers.NewV1Router(authService, chatService, keys)
 	router.Mount("/api/v1", apiRouter)
 
+	// Public keys for services that verify our tokens
+	controllers.NewJWKSController(keys).RegisterRoutes(router)
+
 	// WebSocket handler
-	router.Get("/api/v1/ws", realtime.HandleWebSocket)
+	hub.SetMessageSender(chatService)
+	hub.SetMembershipChecker(chatService)
+	hub.SetPresenceStore(chatService)
+	hub.SetMessageReplayer(chatService)
+	hub.SetSessionChecker(authService)
+	router.Get("/api/v1/ws", hub.HandleWebSocket)
 
 	// Static file server for web client (if exists)
 	fs := http.FileServer(http.Dir("./web/dist"))
@@ -128,6 +176,11 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	if err := hub.Close(); err != nil {
+		log.Printf("Error closing broadcast backend: %v", err)
+	}
+	close(stopReloading)
+
 	log.Println("Server exited gracefully")
 }
 
@@ -188,15 +241,52 @@ func setupDatabase() (*gorm.DB, error) {
 	
 	// Auto-migrate the database schema
 	log.Println("Running database migrations...")
-	err = db.AutoMigrate(&models.User{}, &models.Room{}, &models.Message{})
+	err = db.AutoMigrate(&models.User{}, &models.Room{}, &models.Message{}, &models.MessageRevision{}, &models.Reaction{}, &models.Mention{}, &models.ReadReceipt{}, &models.RoomMember{}, &models.RoomInvite{}, &models.RoomBan{}, &models.Session{}, &models.RefreshToken{}, &models.PasswordResetToken{}, &models.RecoveryCode{}, &models.LoginChallenge{})
 	if err != nil {
 		return nil, fmt.Errorf("migration failed: %w", err)
 	}
+	if err := repositories.MigrateMessageSearch(db); err != nil {
+		return nil, err
+	}
+	if err := repositories.MigrateMessageSeq(db); err != nil {
+		return nil, err
+	}
+	if err := repositories.MigrateRoomMembers(db); err != nil {
+		return nil, err
+	}
 	log.Println("Database migrations completed successfully")
 	
 	return db, nil
 }
 
+// setupSigningKeys loads the token signing keys from JWT_KEY_DIR, generating
+// a first key when the directory has none
+func setupSigningKeys() (*jwtkeys.KeySet, error) {
+	dir := os.Getenv("JWT_KEY_DIR")
+	if dir == "" {
+		dir = "./keys"
+	}
+
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) == 0 {
+		log.Printf("No signing keys in %s, generating one", dir)
+		kid, err := jwtkeys.Generate(dir, "EdDSA")
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Generated signing key %s", kid)
+	}
+
+	keys, err := jwtkeys.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !keys.HasSigningKey() {
+		return nil, fmt.Errorf("%s holds no private key to sign tokens with", dir)
+	}
+	log.Printf("Loaded signing keys from %s", dir)
+	return keys, nil
+}
+
 // maskPassword replaces the password in a connection string with ****
 func maskPassword(connectionString string) string {
 	// This is a simple implementation - you might want to use regex for a more robust version
@@ -210,3 +300,24 @@ func maskPassword(connectionString string) string {
 	}
 	return strings.Join(parts, ":")
 }
+
+// envInt reads a whole number from the environment, returning 0 when it is
+// unset or invalid
+func envInt(name string) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// parseList splits a comma-separated environment value, dropping empty entries
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
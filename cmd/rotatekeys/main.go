@@ -0,0 +1,50 @@
+// Command rotatekeys adds a new token signing key to the key directory and
+// removes the oldest ones. Servers reread the directory every minute and sign
+// with a new key once it is two minutes old, so every server can verify its
+// tokens by then.
+//
+//	go run ./cmd/rotatekeys -dir ./keys -alg EdDSA -keep 3
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/jwtkeys"
+)
+
+func main() {
+	dir := os.Getenv("JWT_KEY_DIR")
+	if dir == "" {
+		dir = "./keys"
+	}
+
+	var alg string
+	var keep int
+	flag.StringVar(&dir, "dir", dir, "Key directory (default: JWT_KEY_DIR or ./keys)")
+	flag.StringVar(&alg, "alg", "EdDSA", "Algorithm of the new key: EdDSA or RS256")
+	flag.IntVar(&keep, "keep", 3, "Private keys to keep, the new one included; older ones are removed")
+	flag.Parse()
+
+	// The previous key keeps signing until the new one is active, and its
+	// tokens must verify until they expire
+	if keep < 2 {
+		log.Fatalf("-keep must be at least 2 so tokens signed with the previous key keep verifying")
+	}
+
+	kid, err := jwtkeys.Generate(dir, alg)
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+	fmt.Printf("Added %s key %s\n", alg, kid)
+
+	removed, err := jwtkeys.Prune(dir, keep)
+	for _, id := range removed {
+		fmt.Printf("Removed key %s\n", id)
+	}
+	if err != nil {
+		log.Fatalf("Failed to remove old keys: %v", err)
+	}
+}
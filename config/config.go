@@ -9,7 +9,7 @@ import (
 
 type Config struct {
 	DBUrl     string
-	JwtSecret string
+	JwtKeyDir string
 	RedisUrl  string
 	Port      string
 }
@@ -22,7 +22,7 @@ func LoadConfig() Config {
 
 	cfg := Config{
 		DBUrl:     os.Getenv("PG_URL"),
-		JwtSecret: os.Getenv("JWT_SECRET"),
+		JwtKeyDir: os.Getenv("JWT_KEY_DIR"),
 		RedisUrl:  os.Getenv("REDIS_URL"),
 		Port:      "PORT",
 	}
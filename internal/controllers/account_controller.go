@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+type AccountController struct {
+	authService services.AuthService
+}
+
+func NewAccountController(authService services.AuthService) *AccountController {
+	return &AccountController{
+		authService: authService,
+	}
+}
+
+// RegisterRoutes registers all account-related routes
+func (c *AccountController) RegisterRoutes(r chi.Router) {
+	r.Put("/account/password", c.ChangePassword)
+	r.Delete("/account", c.DeleteAccount)
+	r.Get("/account/2fa", c.TwoFactorStatus)
+	r.Post("/account/2fa", c.EnrollTwoFactor)
+	r.Post("/account/2fa/verify", c.ActivateTwoFactor)
+	r.Delete("/account/2fa", c.DisableTwoFactor)
+	r.Post("/users/{username}/password-reset", c.AdminResetPassword)
+}
+
+// ChangePassword sets a new password for the caller and logs out their other
+// sessions. Callers with two-factor authentication on also send a code.
+func (c *AccountController) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+		Code        string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OldPassword == "" || req.NewPassword == "" {
+		http.Error(w, "old_password and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sessionID, _ := r.Context().Value("sessionID").(string)
+
+	if err := c.authService.ChangePassword(userID, sessionID, req.OldPassword, req.NewPassword, req.Code); err != nil {
+		writeAccountError(w, err, "Error changing password: ")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteAccount deletes the caller's account once they confirm their
+// password, and a code if they have two-factor authentication on
+func (c *AccountController) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		http.Error(w, "password is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := c.authService.DeleteAccount(userID, req.Password, req.Code); err != nil {
+		writeAccountError(w, err, "Error deleting account: ")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminResetPassword lets an administrator send a user a password reset
+// token, logging the user out everywhere
+func (c *AccountController) AdminResetPassword(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	if username == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := c.authService.AdminResetPassword(userID, username); err != nil {
+		writeAccountError(w, err, "Error resetting password: ")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// TwoFactorStatus tells whether the caller has two-factor authentication on
+func (c *AccountController) TwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := c.authService.TwoFactorStatus(userID)
+	if err != nil {
+		writeAccountError(w, err, "Error getting two-factor status: ")
+		return
+	}
+
+	json.NewEncoder(w).Encode(status)
+}
+
+// EnrollTwoFactor gives the caller a new authenticator secret, which takes
+// effect once verified
+func (c *AccountController) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := c.authService.EnrollTOTP(userID)
+	if err != nil {
+		writeAccountError(w, err, "Error setting up two-factor authentication: ")
+		return
+	}
+
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// ActivateTwoFactor turns two-factor authentication on with a code of the
+// caller's authenticator and returns their recovery codes
+func (c *AccountController) ActivateTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := c.authService.ActivateTOTP(userID, req.Code)
+	if err != nil {
+		writeAccountError(w, err, "Error enabling two-factor authentication: ")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string][]string{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off once the caller
+// confirms their password and a code
+func (c *AccountController) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" || req.Code == "" {
+		http.Error(w, "password and code are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := c.authService.DisableTOTP(userID, req.Password, req.Code); err != nil {
+		writeAccountError(w, err, "Error disabling two-factor authentication: ")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAccountError maps the errors of account operations to HTTP responses
+func writeAccountError(w http.ResponseWriter, err error, prefix string) {
+	switch err {
+	case services.ErrInvalidCredentials:
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+	case services.ErrEmptyPassword:
+		http.Error(w, "Password cannot be empty", http.StatusBadRequest)
+	case services.ErrUserNotFound:
+		http.Error(w, "User not found", http.StatusNotFound)
+	case services.ErrForbidden:
+		http.Error(w, "Only administrators can reset other users' passwords", http.StatusForbidden)
+	case services.ErrInvalidCode:
+		http.Error(w, "Invalid two-factor code", http.StatusForbidden)
+	case services.ErrCodeRequired:
+		http.Error(w, "Two-factor code required", http.StatusForbidden)
+	case services.ErrTwoFactorEnabled:
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+	case services.ErrTwoFactorNotEnabled:
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+	case services.ErrTwoFactorNotEnrolled:
+		http.Error(w, "Set up two-factor authentication first", http.StatusConflict)
+	default:
+		http.Error(w, prefix+err.Error(), http.StatusInternalServerError)
+	}
+}
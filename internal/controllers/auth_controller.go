@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 
 	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
@@ -22,6 +23,11 @@ func NewAuthController(authService services.AuthService) *AuthController {
 func (c *AuthController) RegisterRoutes(r chi.Router) {
 	r.Post("/register", c.Register)
 	r.Post("/login", c.Login)
+	r.Post("/login/2fa", c.CompleteLogin)
+	r.Post("/token/refresh", c.Refresh)
+	r.Post("/logout", c.Logout)
+	r.Post("/password/forgot", c.ForgotPassword)
+	r.Post("/password/reset", c.ResetPassword)
 }
 
 // Register handles user registration
@@ -57,11 +63,14 @@ func (c *AuthController) Register(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Login handles user authentication
+// Login handles user authentication, starting a session for the device. Users
+// with two-factor authentication get a challenge to complete at /login/2fa.
 func (c *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		DeviceLabel   string `json:"device_label"`
+		ClientVersion string `json:"client_version"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -73,7 +82,16 @@ func (c *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	token, err := c.authService.Login(req.Username, req.Password)
+	device := services.DeviceInfo{
+		Label:         req.DeviceLabel,
+		ClientVersion: req.ClientVersion,
+		IPAddress:     clientIP(r),
+	}
+	if device.Label == "" {
+		device.Label = r.UserAgent()
+	}
+
+	result, err := c.authService.Login(req.Username, req.Password, device)
 	if err != nil {
 		switch err {
 		case services.ErrUserNotFound, services.ErrInvalidCredentials:
@@ -83,8 +101,149 @@ func (c *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+
+	if result.Challenge != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"two_factor_required": true,
+			"challenge":           result.Challenge,
+			"expires_in":          int(services.LoginChallengeTTL.Seconds()),
+		})
+		return
+	}
 	
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": token,
-	})
+	json.NewEncoder(w).Encode(loginResponse{TokenPair: result.Tokens, Token: result.Tokens.AccessToken})
+}
+
+// CompleteLogin finishes a login challenged for a second factor, taking an
+// authenticator code or a recovery code
+func (c *AuthController) CompleteLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Challenge == "" || req.Code == "" {
+		http.Error(w, "challenge and code are required", http.StatusBadRequest)
+		return
+	}
+
+	pair, err := c.authService.CompleteLogin(req.Challenge, req.Code)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidChallenge:
+			http.Error(w, "Invalid or expired login, please log in again", http.StatusUnauthorized)
+		case services.ErrInvalidCode:
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Authentication failed: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(loginResponse{TokenPair: pair, Token: pair.AccessToken})
+}
+
+// loginResponse is a token pair, plus the access token under its old name
+// for clients written before refresh tokens
+type loginResponse struct {
+	*services.TokenPair
+	Token string `json:"token"`
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token
+func (c *AuthController) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	pair, err := c.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidRefreshToken:
+			http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Token refresh failed: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(pair)
+}
+
+// Logout revokes the session of the refresh token, ending the login it came from
+func (c *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.authService.Logout(req.RefreshToken); err != nil {
+		switch err {
+		case services.ErrInvalidRefreshToken:
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Logout failed: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword sends the user a password reset token. It answers the same
+// whether or not the user exists.
+func (c *AuthController) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		http.Error(w, "username is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.authService.RequestPasswordReset(req.Username); err != nil {
+		http.Error(w, "Password reset failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password with a reset token
+func (c *AuthController) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.NewPassword == "" {
+		http.Error(w, "token and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.authService.ResetPassword(req.Token, req.NewPassword); err != nil {
+		switch err {
+		case services.ErrInvalidResetToken:
+			http.Error(w, "Invalid or expired reset token", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Password reset failed: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientIP returns the address a request came from
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+type DirectController struct {
+	chatService services.ChatService
+}
+
+func NewDirectController(chatService services.ChatService) *DirectController {
+	return &DirectController{
+		chatService: chatService,
+	}
+}
+
+// RegisterRoutes registers all direct-message routes
+func (c *DirectController) RegisterRoutes(r chi.Router) {
+	r.Get("/dm", c.ListConversations)
+	r.Get("/dm/{username}", c.GetConversation)
+	r.Post("/dm/{username}/messages", c.SendMessage)
+}
+
+// ListConversations lists the current user's direct conversations, most recently active first
+func (c *DirectController) ListConversations(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversations, err := c.chatService.ListDirectConversations(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving conversations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(conversations)
+}
+
+// GetConversation returns the room of the direct conversation with a user.
+// Its messages are read through the usual room endpoints.
+func (c *DirectController) GetConversation(w http.ResponseWriter, r *http.Request) {
+	peer := chi.URLParam(r, "username")
+	if peer == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	room, err := c.chatService.GetDirectConversation(userID, peer)
+	if err != nil {
+		writeDirectError(w, err, "Error retrieving conversation: ")
+		return
+	}
+
+	json.NewEncoder(w).Encode(room)
+}
+
+// SendMessage sends a direct message to a user, starting the conversation if needed
+func (c *DirectController) SendMessage(w http.ResponseWriter, r *http.Request) {
+	peer := chi.URLParam(r, "username")
+	if peer == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Content == "" {
+		http.Error(w, "Message content is required", http.StatusBadRequest)
+		return
+	}
+
+	message, err := c.chatService.SendDirectMessage(userID, peer, req.Content)
+	if err != nil {
+		writeDirectError(w, err, "Error sending message: ")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(message)
+}
+
+// writeDirectError responds to a failed direct-message request
+func writeDirectError(w http.ResponseWriter, err error, prefix string) {
+	switch err {
+	case services.ErrUserNotFound:
+		http.Error(w, "User not found", http.StatusNotFound)
+	case services.ErrNoConversation:
+		http.Error(w, "No conversation with this user yet", http.StatusNotFound)
+	case services.ErrMessageSelf:
+		http.Error(w, "You cannot message yourself", http.StatusBadRequest)
+	case services.ErrEmptyMessage:
+		http.Error(w, "Message content is required", http.StatusBadRequest)
+	default:
+		http.Error(w, prefix+err.Error(), http.StatusInternalServerError)
+	}
+}
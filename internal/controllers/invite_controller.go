@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+type InviteController struct {
+	chatService services.ChatService
+}
+
+func NewInviteController(chatService services.ChatService) *InviteController {
+	return &InviteController{
+		chatService: chatService,
+	}
+}
+
+// RegisterRoutes registers all invite-related routes
+func (c *InviteController) RegisterRoutes(r chi.Router) {
+	r.Post("/rooms/{roomID}/invites", c.CreateInvite)
+	r.Get("/rooms/{roomID}/invites", c.ListInvites)
+	r.Delete("/rooms/{roomID}/invites/{inviteID}", c.RevokeInvite)
+	r.Post("/invites/{token}/accept", c.AcceptInvite)
+}
+
+// CreateInvite creates an invite to a room. expires_in is in seconds and
+// defaults to a day; max_uses 0 allows any number of uses.
+func (c *InviteController) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ExpiresIn int `json:"expires_in"`
+		MaxUses   int `json:"max_uses"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	invite, err := c.chatService.CreateInvite(roomID, userID, time.Duration(req.ExpiresIn)*time.Second, req.MaxUses)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidInviteSpec:
+			http.Error(w, "expires_in must be at most 30 days and max_uses cannot be negative", http.StatusBadRequest)
+		default:
+			writeRoomAdminError(w, err, "Error creating invite: ")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invite)
+}
+
+// ListInvites lists the invites of a room that can still be used
+func (c *InviteController) ListInvites(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	invites, err := c.chatService.ListInvites(roomID, userID)
+	if err != nil {
+		writeRoomAdminError(w, err, "Error retrieving invites: ")
+		return
+	}
+
+	json.NewEncoder(w).Encode(invites)
+}
+
+// RevokeInvite stops an invite from being used
+func (c *InviteController) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	inviteID := chi.URLParam(r, "inviteID")
+	if roomID == "" || inviteID == "" {
+		http.Error(w, "Room ID and invite ID are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := c.chatService.RevokeInvite(roomID, inviteID, userID); err != nil {
+		switch err {
+		case services.ErrInviteNotFound:
+			http.Error(w, "Invite not found", http.StatusNotFound)
+		default:
+			writeRoomAdminError(w, err, "Error revoking invite: ")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptInvite makes the current user a member of the invite's room
+func (c *InviteController) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		http.Error(w, "Invite token is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	room, err := c.chatService.AcceptInvite(token, userID)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidInvite:
+			http.Error(w, "Invite is invalid, expired or used up", http.StatusForbidden)
+		case services.ErrRoomNotFound:
+			http.Error(w, "Room not found", http.StatusNotFound)
+		case services.ErrBanned:
+			http.Error(w, "You are banned from this room", http.StatusForbidden)
+		default:
+			http.Error(w, "Error accepting invite: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(room)
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/jwtkeys"
+	"github.com/go-chi/chi/v5"
+)
+
+type JWKSController struct {
+	keys *jwtkeys.KeySet
+}
+
+func NewJWKSController(keys *jwtkeys.KeySet) *JWKSController {
+	return &JWKSController{
+		keys: keys,
+	}
+}
+
+// RegisterRoutes registers the key discovery route; it belongs at the root of
+// the server, not under /api/v1
+func (c *JWKSController) RegisterRoutes(r chi.Router) {
+	r.Get("/.well-known/jwks.json", c.GetJWKS)
+}
+
+// GetJWKS publishes the public keys access tokens are verified with
+func (c *JWKSController) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// Keys are reread every minute, so clients need not cache them longer
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	json.NewEncoder(w).Encode(c.keys.JWKS())
+}
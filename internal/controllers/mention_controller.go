@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+type MentionController struct {
+	chatService services.ChatService
+}
+
+func NewMentionController(chatService services.ChatService) *MentionController {
+	return &MentionController{
+		chatService: chatService,
+	}
+}
+
+// RegisterRoutes registers all mention-related routes
+func (c *MentionController) RegisterRoutes(r chi.Router) {
+	r.Get("/mentions", c.GetMentions)
+}
+
+// GetMentions lists the messages that mentioned the caller, newest first
+func (c *MentionController) GetMentions(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	mentions, err := c.chatService.GetMentions(userID, limit)
+	if err != nil {
+		http.Error(w, "Error retrieving mentions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(mentions)
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+type ModerationController struct {
+	chatService services.ChatService
+}
+
+func NewModerationController(chatService services.ChatService) *ModerationController {
+	return &ModerationController{
+		chatService: chatService,
+	}
+}
+
+// RegisterRoutes registers all room moderation routes
+func (c *ModerationController) RegisterRoutes(r chi.Router) {
+	r.Delete("/rooms/{roomID}/members/{username}", c.KickMember)
+	r.Put("/rooms/{roomID}/members/{username}/mute", c.MuteMember)
+	r.Delete("/rooms/{roomID}/members/{username}/mute", c.UnmuteMember)
+	r.Get("/rooms/{roomID}/bans", c.ListBans)
+	r.Put("/rooms/{roomID}/bans/{username}", c.BanMember)
+	r.Delete("/rooms/{roomID}/bans/{username}", c.UnbanMember)
+}
+
+// KickMember removes a member from a room
+func (c *ModerationController) KickMember(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	member := chi.URLParam(r, "username")
+	if roomID == "" || member == "" {
+		http.Error(w, "Room ID and username are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := c.chatService.KickMember(roomID, userID, member); err != nil {
+		writeModerationError(w, err, "Error kicking member: ")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BanMember removes a user from a room and keeps them from rejoining
+func (c *ModerationController) BanMember(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	member := chi.URLParam(r, "username")
+	if roomID == "" || member == "" {
+		http.Error(w, "Room ID and username are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ban, err := c.chatService.BanMember(roomID, userID, member)
+	if err != nil {
+		switch err {
+		case services.ErrUserNotFound:
+			http.Error(w, "User not found", http.StatusNotFound)
+		default:
+			writeModerationError(w, err, "Error banning user: ")
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(ban)
+}
+
+// UnbanMember lets a banned user join the room again
+func (c *ModerationController) UnbanMember(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	member := chi.URLParam(r, "username")
+	if roomID == "" || member == "" {
+		http.Error(w, "Room ID and username are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := c.chatService.UnbanMember(roomID, userID, member); err != nil {
+		switch err {
+		case services.ErrNotBanned:
+			http.Error(w, "User is not banned from this room", http.StatusNotFound)
+		default:
+			writeRoomAdminError(w, err, "Error unbanning user: ")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListBans lists the users banned from a room
+func (c *ModerationController) ListBans(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	bans, err := c.chatService.ListBans(roomID, userID)
+	if err != nil {
+		writeRoomAdminError(w, err, "Error retrieving bans: ")
+		return
+	}
+
+	json.NewEncoder(w).Encode(bans)
+}
+
+// MuteMember keeps a member from posting for duration seconds
+func (c *ModerationController) MuteMember(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	member := chi.URLParam(r, "username")
+	if roomID == "" || member == "" {
+		http.Error(w, "Room ID and username are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Duration int `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	muted, err := c.chatService.MuteMember(roomID, userID, member, time.Duration(req.Duration)*time.Second)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidMuteLength:
+			http.Error(w, "duration must be between 1 second and 30 days", http.StatusBadRequest)
+		default:
+			writeModerationError(w, err, "Error muting member: ")
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(muted)
+}
+
+// UnmuteMember lifts a member's mute before it expires
+func (c *ModerationController) UnmuteMember(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	member := chi.URLParam(r, "username")
+	if roomID == "" || member == "" {
+		http.Error(w, "Room ID and username are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	unmuted, err := c.chatService.UnmuteMember(roomID, userID, member)
+	if err != nil {
+		writeModerationError(w, err, "Error unmuting member: ")
+		return
+	}
+
+	json.NewEncoder(w).Encode(unmuted)
+}
+
+// writeModerationError responds to a failed moderation action against a member
+func writeModerationError(w http.ResponseWriter, err error, prefix string) {
+	switch err {
+	case services.ErrForbidden:
+		http.Error(w, "Only the room owner or an admin can do this, admins cannot act on each other, and nobody can act on the owner or themselves", http.StatusForbidden)
+	case services.ErrMemberNotFound:
+		http.Error(w, "Member not found", http.StatusNotFound)
+	default:
+		writeRoomAdminError(w, err, prefix)
+	}
+}
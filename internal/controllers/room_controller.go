@@ -2,8 +2,11 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
 	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
 	"github.com/go-chi/chi/v5"
 )
@@ -20,16 +23,41 @@ func NewRoomController(chatService services.ChatService) *RoomController {
 
 // RegisterRoutes registers all room-related routes
 func (c *RoomController) RegisterRoutes(r chi.Router) {
+	r.Get("/rooms", c.ListRooms)
 	r.Post("/rooms", c.CreateRoom)
 	r.Get("/rooms/code/{code}", c.GetRoomByCode)
+	r.Post("/rooms/code/{code}/join", c.JoinRoom)
+	r.Get("/rooms/unread", c.GetUnreadCounts)
+	r.Get("/rooms/{roomID}/read", c.GetReadReceipt)
+	r.Put("/rooms/{roomID}/read", c.MarkRead)
+	r.Get("/rooms/{roomID}/members", c.GetMembers)
+	r.Put("/rooms/{roomID}/members/{username}", c.SetMemberRole)
+	r.Post("/rooms/{roomID}/code", c.RotateCode)
+	r.Put("/rooms/{roomID}/private", c.SetPrivate)
+	r.Patch("/rooms/{roomID}", c.UpdateRoom)
+	r.Put("/rooms/{roomID}/archived", c.SetArchived)
 	r.Get("/rooms/{roomID}/messages", c.GetMessages)
 	r.Post("/rooms/{roomID}/messages", c.SendMessage)
+	r.Patch("/rooms/{roomID}/messages/{messageID}", c.EditMessage)
+	r.Delete("/rooms/{roomID}/messages/{messageID}", c.DeleteMessage)
+	r.Get("/rooms/{roomID}/messages/{messageID}/history", c.GetMessageHistory)
+	r.Get("/rooms/{roomID}/messages/{messageID}/thread", c.GetThread)
+	r.Put("/rooms/{roomID}/messages/{messageID}/reactions/{emoji}", c.AddReaction)
+	r.Delete("/rooms/{roomID}/messages/{messageID}/reactions/{emoji}", c.RemoveReaction)
 }
 
-// CreateRoom handles room creation requests
+// CreateRoom handles room creation requests; the creator becomes the room's owner
 func (c *RoomController) CreateRoom(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var req struct {
-		Name string `json:"name"`
+		Name    string `json:"name"`
+		Private bool   `json:"private"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -41,11 +69,13 @@ func (c *RoomController) CreateRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	room, err := c.chatService.CreateRoom(req.Name)
+	room, err := c.chatService.CreateRoom(req.Name, userID, req.Private)
 	if err != nil {
 		switch err {
 		case services.ErrEmptyRoomName:
 			http.Error(w, "Room name cannot be empty", http.StatusBadRequest)
+		case services.ErrRoomNameTooLong:
+			http.Error(w, fmt.Sprintf("Room name cannot be longer than %d characters", services.MaxRoomNameLength), http.StatusBadRequest)
 		default:
 			http.Error(w, "Error creating room: "+err.Error(), http.StatusInternalServerError)
 		}
@@ -56,19 +86,62 @@ func (c *RoomController) CreateRoom(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(room)
 }
 
-// GetRoomByCode retrieves a room by its join code
+// ListRooms lists the active rooms the current user has created or joined,
+// or their archived rooms with archived=true
+func (c *RoomController) ListRooms(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	list := c.chatService.ListRooms
+	if archived := r.URL.Query().Get("archived"); archived != "" {
+		showArchived, err := strconv.ParseBool(archived)
+		if err != nil {
+			http.Error(w, "Invalid archived parameter", http.StatusBadRequest)
+			return
+		}
+		if showArchived {
+			list = c.chatService.ListArchivedRooms
+		}
+	}
+
+	rooms, err := list(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving rooms: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rooms)
+}
+
+// GetRoomByCode retrieves a room by its join code. Private rooms need the
+// invite query parameter unless the caller is a member.
 func (c *RoomController) GetRoomByCode(w http.ResponseWriter, r *http.Request) {
 	code := chi.URLParam(r, "code")
 	if code == "" {
 		http.Error(w, "Room code is required", http.StatusBadRequest)
 		return
 	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 	
-	room, err := c.chatService.GetRoomByCode(code)
+	room, err := c.chatService.GetRoomByCode(code, userID, r.URL.Query().Get("invite"))
 	if err != nil {
 		switch err {
 		case services.ErrRoomNotFound:
 			http.Error(w, "Room not found", http.StatusNotFound)
+		case services.ErrInviteRequired:
+			http.Error(w, "This room is private; an invite is required", http.StatusForbidden)
+		case services.ErrInvalidInvite:
+			http.Error(w, "Invite is invalid, expired or used up", http.StatusForbidden)
 		default:
 			http.Error(w, "Error retrieving room: "+err.Error(), http.StatusInternalServerError)
 		}
@@ -78,19 +151,84 @@ func (c *RoomController) GetRoomByCode(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(room)
 }
 
-// GetMessages retrieves all messages for a room
+// JoinRoom makes the current user a member of the room with the given code.
+// Private rooms need the invite query parameter.
+func (c *RoomController) JoinRoom(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	if code == "" {
+		http.Error(w, "Room code is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	room, err := c.chatService.JoinRoom(code, userID, r.URL.Query().Get("invite"))
+	if err != nil {
+		switch err {
+		case services.ErrRoomNotFound:
+			http.Error(w, "Room not found", http.StatusNotFound)
+		case services.ErrInviteRequired:
+			http.Error(w, "This room is private; an invite is required", http.StatusForbidden)
+		case services.ErrInvalidInvite:
+			http.Error(w, "Invite is invalid, expired or used up", http.StatusForbidden)
+		case services.ErrBanned:
+			http.Error(w, "You are banned from this room", http.StatusForbidden)
+		default:
+			http.Error(w, "Error joining room: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(room)
+}
+
+// GetMessages retrieves a page of messages for a room. The before/after query
+// parameters take the next_cursor of a previous page, and around takes the ID
+// of a message to center the page on.
 func (c *RoomController) GetMessages(w http.ResponseWriter, r *http.Request) {
 	roomID := chi.URLParam(r, "roomID")
 	if roomID == "" {
 		http.Error(w, "Room ID is required", http.StatusBadRequest)
 		return
 	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	
+	page := services.MessagePageRequest{
+		Before: r.URL.Query().Get("before"),
+		After:  r.URL.Query().Get("after"),
+		Around: r.URL.Query().Get("around"),
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		page.Limit = value
+	}
 	
-	messages, err := c.chatService.GetMessages(roomID)
+	messages, err := c.chatService.GetMessages(roomID, userID, page)
 	if err != nil {
 		switch err {
+		case services.ErrInvalidCursor:
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
 		case services.ErrRoomNotFound:
 			http.Error(w, "Room not found", http.StatusNotFound)
+		case services.ErrMessageNotFound:
+			http.Error(w, "Message not found", http.StatusNotFound)
+		case services.ErrNotRoomMember:
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
 		default:
 			http.Error(w, "Error retrieving messages: "+err.Error(), http.StatusInternalServerError)
 		}
@@ -100,7 +238,7 @@ func (c *RoomController) GetMessages(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(messages)
 }
 
-// SendMessage adds a new message to a room
+// SendMessage adds a new message to a room, or to a thread when parent_id is set
 func (c *RoomController) SendMessage(w http.ResponseWriter, r *http.Request) {
 	roomID := chi.URLParam(r, "roomID")
 	if roomID == "" {
@@ -116,7 +254,8 @@ func (c *RoomController) SendMessage(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	var req struct {
-		Content string `json:"content"`
+		Content  string `json:"content"`
+		ParentID string `json:"parent_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -128,11 +267,25 @@ func (c *RoomController) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	message, err := c.chatService.SendMessage(roomID, userID, req.Content)
+	var message *models.Message
+	var err error
+	if req.ParentID != "" {
+		message, err = c.chatService.ReplyToMessage(roomID, req.ParentID, userID, req.Content)
+	} else {
+		message, err = c.chatService.SendMessage(roomID, userID, req.Content)
+	}
 	if err != nil {
 		switch err {
 		case services.ErrRoomNotFound:
 			http.Error(w, "Room not found", http.StatusNotFound)
+		case services.ErrNotRoomMember:
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
+		case services.ErrRoomArchived:
+			http.Error(w, "This room is archived", http.StatusConflict)
+		case services.ErrMuted:
+			http.Error(w, "You are muted in this room", http.StatusForbidden)
+		case services.ErrMessageNotFound:
+			http.Error(w, "Parent message not found", http.StatusNotFound)
 		case services.ErrInvalidSenderID:
 			http.Error(w, "Invalid sender ID", http.StatusBadRequest)
 		default:
@@ -144,3 +297,510 @@ func (c *RoomController) SendMessage(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(message)
 }
+
+// EditMessage changes the content of a message sent by the current user
+func (c *RoomController) EditMessage(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	messageID := chi.URLParam(r, "messageID")
+	if roomID == "" || messageID == "" {
+		http.Error(w, "Room ID and message ID are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Content == "" {
+		http.Error(w, "Message content is required", http.StatusBadRequest)
+		return
+	}
+
+	message, err := c.chatService.EditMessage(roomID, messageID, userID, req.Content)
+	if err != nil {
+		switch err {
+		case services.ErrNotRoomMember:
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
+		case services.ErrRoomArchived:
+			http.Error(w, "This room is archived", http.StatusConflict)
+		case services.ErrMessageNotFound:
+			http.Error(w, "Message not found", http.StatusNotFound)
+		case services.ErrNotMessageSender:
+			http.Error(w, "Only the sender can edit this message", http.StatusForbidden)
+		default:
+			http.Error(w, "Error editing message: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(message)
+}
+
+// DeleteMessage retracts a message on behalf of its sender or a moderator
+func (c *RoomController) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	messageID := chi.URLParam(r, "messageID")
+	if roomID == "" || messageID == "" {
+		http.Error(w, "Room ID and message ID are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := c.chatService.DeleteMessage(roomID, messageID, userID)
+	if err != nil {
+		switch err {
+		case services.ErrNotRoomMember:
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
+		case services.ErrRoomArchived:
+			http.Error(w, "This room is archived", http.StatusConflict)
+		case services.ErrMessageNotFound:
+			http.Error(w, "Message not found", http.StatusNotFound)
+		case services.ErrForbidden:
+			http.Error(w, "Only the sender or a moderator can delete this message", http.StatusForbidden)
+		default:
+			http.Error(w, "Error deleting message: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMessageHistory lists the previous revisions of a message
+func (c *RoomController) GetMessageHistory(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	messageID := chi.URLParam(r, "messageID")
+	if roomID == "" || messageID == "" {
+		http.Error(w, "Room ID and message ID are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	revisions, err := c.chatService.GetMessageHistory(roomID, messageID, userID)
+	if err != nil {
+		switch err {
+		case services.ErrNotRoomMember:
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
+		case services.ErrMessageNotFound:
+			http.Error(w, "Message not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Error retrieving message history: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// GetThread retrieves a message together with its replies
+func (c *RoomController) GetThread(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	messageID := chi.URLParam(r, "messageID")
+	if roomID == "" || messageID == "" {
+		http.Error(w, "Room ID and message ID are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parent, replies, err := c.chatService.GetThread(roomID, messageID, userID)
+	if err != nil {
+		switch err {
+		case services.ErrNotRoomMember:
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
+		case services.ErrMessageNotFound:
+			http.Error(w, "Message not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Error retrieving thread: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"parent":  parent,
+		"replies": replies,
+	})
+}
+
+// AddReaction reacts to a message with an emoji shortcode
+func (c *RoomController) AddReaction(w http.ResponseWriter, r *http.Request) {
+	c.updateReaction(w, r, c.chatService.AddReaction)
+}
+
+// RemoveReaction withdraws the current user's reaction to a message
+func (c *RoomController) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	c.updateReaction(w, r, c.chatService.RemoveReaction)
+}
+
+// updateReaction applies a reaction change and responds with the message's reaction counts
+func (c *RoomController) updateReaction(w http.ResponseWriter, r *http.Request, update func(roomID, messageID, userID, emoji string) ([]models.ReactionCount, error)) {
+	roomID := chi.URLParam(r, "roomID")
+	messageID := chi.URLParam(r, "messageID")
+	emoji := chi.URLParam(r, "emoji")
+	if roomID == "" || messageID == "" || emoji == "" {
+		http.Error(w, "Room ID, message ID and emoji are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	reactions, err := update(roomID, messageID, userID, emoji)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidEmoji:
+			http.Error(w, "Invalid emoji shortcode", http.StatusBadRequest)
+		case services.ErrNotRoomMember:
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
+		case services.ErrRoomArchived:
+			http.Error(w, "This room is archived", http.StatusConflict)
+		case services.ErrMessageNotFound:
+			http.Error(w, "Message not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Error updating reaction: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(reactions)
+}
+
+// GetUnreadCounts lists the unread message count of each of the current user's rooms
+func (c *RoomController) GetUnreadCounts(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	counts, err := c.chatService.GetUnreadCounts(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving unread counts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(counts)
+}
+
+// GetReadReceipt returns how far the current user has read in a room
+func (c *RoomController) GetReadReceipt(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	receipt, err := c.chatService.GetReadReceipt(roomID, userID)
+	if err != nil {
+		switch err {
+		case services.ErrReceiptNotFound:
+			http.Error(w, "Nothing read in this room yet", http.StatusNotFound)
+		default:
+			http.Error(w, "Error retrieving read receipt: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(receipt)
+}
+
+// MarkRead advances the current user's read pointer in a room to a message
+func (c *RoomController) MarkRead(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		MessageID string `json:"message_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.MessageID == "" {
+		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	receipt, err := c.chatService.MarkRead(roomID, req.MessageID, userID)
+	if err != nil {
+		switch err {
+		case services.ErrNotRoomMember:
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
+		case services.ErrMessageNotFound:
+			http.Error(w, "Message not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Error updating read receipt: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(receipt)
+}
+
+// GetMembers lists the members of a room with their roles and presence
+func (c *RoomController) GetMembers(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	members, err := c.chatService.GetMembers(roomID, userID)
+	if err != nil {
+		switch err {
+		case services.ErrNotRoomMember:
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
+		default:
+			http.Error(w, "Error retrieving members: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(members)
+}
+
+// SetMemberRole lets the room owner promote a member to admin or demote an admin
+func (c *RoomController) SetMemberRole(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	member := chi.URLParam(r, "username")
+	if roomID == "" || member == "" {
+		http.Error(w, "Room ID and username are required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := c.chatService.SetMemberRole(roomID, userID, member, req.Role)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidRole:
+			http.Error(w, "Role must be admin or member", http.StatusBadRequest)
+		case services.ErrNotRoomMember:
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
+		case services.ErrForbidden:
+			http.Error(w, "Only the owner can change roles, and the owner's role cannot change", http.StatusForbidden)
+		case services.ErrMemberNotFound:
+			http.Error(w, "Member not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Error updating role: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+// RotateCode gives a room a new join code, invalidating the old one
+func (c *RoomController) RotateCode(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	room, err := c.chatService.RotateRoomCode(roomID, userID)
+	if err != nil {
+		writeRoomAdminError(w, err, "Error rotating room code: ")
+		return
+	}
+
+	json.NewEncoder(w).Encode(room)
+}
+
+// SetPrivate makes a room invite-only, or open to anyone with its code
+func (c *RoomController) SetPrivate(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Private *bool `json:"private"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Private == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	room, err := c.chatService.SetRoomPrivate(roomID, userID, *req.Private)
+	if err != nil {
+		writeRoomAdminError(w, err, "Error updating room: ")
+		return
+	}
+
+	json.NewEncoder(w).Encode(room)
+}
+
+// UpdateRoom renames a room or changes its topic
+func (c *RoomController) UpdateRoom(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name  *string `json:"name"`
+		Topic *string `json:"topic"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Name == nil && req.Topic == nil) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	room, err := c.chatService.UpdateRoom(roomID, userID, services.RoomUpdate{Name: req.Name, Topic: req.Topic})
+	if err != nil {
+		switch err {
+		case services.ErrEmptyRoomName:
+			http.Error(w, "Room name cannot be empty", http.StatusBadRequest)
+		case services.ErrRoomNameTooLong:
+			http.Error(w, fmt.Sprintf("Room name cannot be longer than %d characters", services.MaxRoomNameLength), http.StatusBadRequest)
+		case services.ErrTopicTooLong:
+			http.Error(w, fmt.Sprintf("Room topic cannot be longer than %d characters", services.MaxTopicLength), http.StatusBadRequest)
+		default:
+			writeRoomAdminError(w, err, "Error updating room: ")
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(room)
+}
+
+// SetArchived archives a room, making it read-only, or restores it
+func (c *RoomController) SetArchived(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Archived *bool `json:"archived"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Archived == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	room, err := c.chatService.SetRoomArchived(roomID, userID, *req.Archived)
+	if err != nil {
+		writeRoomAdminError(w, err, "Error updating room: ")
+		return
+	}
+
+	json.NewEncoder(w).Encode(room)
+}
+
+// writeRoomAdminError responds to a failed action reserved for room owners and admins
+func writeRoomAdminError(w http.ResponseWriter, err error, prefix string) {
+	switch err {
+	case services.ErrNotRoomMember:
+		http.Error(w, "You are not a member of this room", http.StatusForbidden)
+	case services.ErrForbidden:
+		http.Error(w, "Only the room owner or an admin can do this", http.StatusForbidden)
+	case services.ErrRoomNotFound:
+		http.Error(w, "Room not found", http.StatusNotFound)
+	default:
+		http.Error(w, prefix+err.Error(), http.StatusInternalServerError)
+	}
+}
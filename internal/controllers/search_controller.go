@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+type SearchController struct {
+	chatService services.ChatService
+}
+
+func NewSearchController(chatService services.ChatService) *SearchController {
+	return &SearchController{
+		chatService: chatService,
+	}
+}
+
+// RegisterRoutes registers all search-related routes
+func (c *SearchController) RegisterRoutes(r chi.Router) {
+	r.Get("/search/messages", c.SearchMessages)
+}
+
+// SearchMessages runs a full-text search over the messages of the caller's rooms.
+// Dates in from/to may be RFC 3339 timestamps or YYYY-MM-DD; to is exclusive.
+func (c *SearchController) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	search := services.MessageSearchRequest{
+		Query:    params.Get("q"),
+		RoomID:   params.Get("room_id"),
+		SenderID: params.Get("sender"),
+	}
+
+	var err error
+	if search.From, err = parseSearchDate(params.Get("from")); err != nil {
+		http.Error(w, "Invalid from date", http.StatusBadRequest)
+		return
+	}
+	if search.To, err = parseSearchDate(params.Get("to")); err != nil {
+		http.Error(w, "Invalid to date", http.StatusBadRequest)
+		return
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if search.Limit, err = strconv.Atoi(limit); err != nil || search.Limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	hits, err := c.chatService.SearchMessages(userID, search)
+	if err != nil {
+		switch err {
+		case services.ErrEmptySearchQuery:
+			http.Error(w, "Search query is required", http.StatusBadRequest)
+		default:
+			http.Error(w, "Error searching messages: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(hits)
+}
+
+// parseSearchDate accepts an RFC 3339 timestamp or a YYYY-MM-DD date
+func parseSearchDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+type SessionController struct {
+	authService services.AuthService
+}
+
+func NewSessionController(authService services.AuthService) *SessionController {
+	return &SessionController{
+		authService: authService,
+	}
+}
+
+// RegisterRoutes registers all session-related routes
+func (c *SessionController) RegisterRoutes(r chi.Router) {
+	r.Get("/sessions", c.ListSessions)
+	r.Delete("/sessions/{sessionID}", c.RevokeSession)
+}
+
+// ListSessions lists the caller's active sessions, one per logged-in device
+func (c *SessionController) ListSessions(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sessionID, _ := r.Context().Value("sessionID").(string)
+
+	sessions, err := c.authService.ListSessions(userID, sessionID)
+	if err != nil {
+		http.Error(w, "Error retrieving sessions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSession logs one of the caller's sessions out
+func (c *SessionController) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "sessionID")
+	if sessionID == "" {
+		http.Error(w, "Session ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := c.authService.RevokeSession(userID, sessionID); err != nil {
+		switch err {
+		case services.ErrSessionNotFound:
+			http.Error(w, "Session not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Error revoking session: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
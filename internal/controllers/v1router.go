@@ -1,30 +1,43 @@
 package controllers
 
 import (
-	"os"
-
+	"github.com/c0sm0thecoder/cli-chat-app/internal/jwtkeys"
 	"github.com/c0sm0thecoder/cli-chat-app/internal/middlewares"
 	"github.com/c0sm0thecoder/cli-chat-app/internal/services"
 	"github.com/go-chi/chi/v5"
 )
 
 // NewV1Router creates a new router for API v1
-func NewV1Router(authService services.AuthService, chatService services.ChatService) chi.Router {
+func NewV1Router(authService services.AuthService, chatService services.ChatService, keys *jwtkeys.KeySet) chi.Router {
 	r := chi.NewRouter()
 
 	// Create controllers
 	authController := NewAuthController(authService)
 	roomController := NewRoomController(chatService)
+	searchController := NewSearchController(chatService)
+	mentionController := NewMentionController(chatService)
+	inviteController := NewInviteController(chatService)
+	directController := NewDirectController(chatService)
+	moderationController := NewModerationController(chatService)
+	sessionController := NewSessionController(authService)
+	accountController := NewAccountController(authService)
 
 	// Register public routes (no authentication required)
 	authController.RegisterRoutes(r)
 
 	// Protected routes that require authentication
 	r.Group(func(r chi.Router) {
-		r.Use(middlewares.JWTMiddleware(os.Getenv("JWT_SECRET")))
+		r.Use(middlewares.JWTMiddleware(keys, authService))
 		
 		// Register protected routes
 		roomController.RegisterRoutes(r)
+		searchController.RegisterRoutes(r)
+		mentionController.RegisterRoutes(r)
+		inviteController.RegisterRoutes(r)
+		directController.RegisterRoutes(r)
+		moderationController.RegisterRoutes(r)
+		sessionController.RegisterRoutes(r)
+		accountController.RegisterRoutes(r)
 	})
 
 	return r
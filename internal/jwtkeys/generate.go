@@ -0,0 +1,120 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// rsaKeyBits is the size of generated RSA keys
+const rsaKeyBits = 3072
+
+// Generate writes a new private key to the directory, creating it if needed,
+// and returns its key ID. alg is EdDSA or RS256. Servers start signing with
+// it after the activation delay.
+func Generate(dir, alg string) (string, error) {
+	var private interface{}
+	var err error
+	switch alg {
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q, use EdDSA or RS256", alg)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	kid, err := newKeyID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create key directory: %w", err)
+	}
+	path := filepath.Join(dir, kid+privateKeySuffix)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to write key: %w", err)
+	}
+	defer file.Close()
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return "", fmt.Errorf("failed to write key: %w", err)
+	}
+	return kid, file.Close()
+}
+
+// Prune removes all but the newest keep private keys of the directory and
+// returns the IDs of the removed keys. Tokens signed with them stop
+// verifying, so keep at least the keys used within the access token lifetime.
+func Prune(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	type keyFile struct {
+		id      string
+		path    string
+		modTime time.Time
+	}
+	var files []keyFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, privateKeySuffix) || strings.HasSuffix(name, publicKeySuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", name, err)
+		}
+		files = append(files, keyFile{
+			id:      strings.TrimSuffix(name, privateKeySuffix),
+			path:    filepath.Join(dir, name),
+			modTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.After(files[j].modTime)
+		}
+		return files[i].id > files[j].id
+	})
+
+	var removed []string
+	for i := keep; i < len(files); i++ {
+		if err := os.Remove(files[i].path); err != nil {
+			return removed, fmt.Errorf("failed to remove key %s: %w", files[i].id, err)
+		}
+		removed = append(removed, files[i].id)
+	}
+	return removed, nil
+}
+
+// newKeyID names a key after when it was made, with a random suffix
+func newKeyID() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix), nil
+}
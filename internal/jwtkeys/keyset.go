@@ -0,0 +1,252 @@
+// Package jwtkeys manages the asymmetric keys access tokens are signed and
+// verified with. Keys live in a directory, one PEM file per key named after
+// its key ID, so they can be rotated without sharing a secret: other services
+// verify our tokens with the public keys published as a JWKS document.
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// ReloadInterval is how often a server rereads its key directory
+	ReloadInterval = time.Minute
+	// ActivationDelay is how long a new key is only used to verify before it
+	// signs, so every server has loaded it by the time tokens carry it
+	ActivationDelay = 2 * ReloadInterval
+
+	// privateKeySuffix ends the file name of a key we can sign with
+	privateKeySuffix = ".pem"
+	// publicKeySuffix ends the file name of a key we can only verify with
+	publicKeySuffix = ".pub.pem"
+)
+
+var (
+	// ErrNoSigningKey means the key directory holds no private key
+	ErrNoSigningKey = errors.New("no signing key")
+	// ErrUnknownKey means a token names a key we do not have
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// key is one key of the set, with its private half if we can sign with it
+type key struct {
+	id       string
+	method   jwt.SigningMethod
+	private  interface{} // *rsa.PrivateKey or ed25519.PrivateKey; nil for verification-only keys
+	public   interface{} // *rsa.PublicKey or ed25519.PublicKey
+	loadedAt time.Time   // When the key file was written
+}
+
+// KeySet holds the keys of a key directory: every key verifies tokens, and
+// the newest active private key signs new ones
+type KeySet struct {
+	dir string
+
+	mu     sync.RWMutex
+	keys   map[string]*key
+	signer *key
+}
+
+// Load reads the keys of a directory. Private keys are PKCS#8 PEM files named
+// <kid>.pem; public keys of verification-only keys are PKIX PEM files named
+// <kid>.pub.pem. RSA keys sign with RS256 and Ed25519 keys with EdDSA.
+func Load(dir string) (*KeySet, error) {
+	keySet := &KeySet{dir: dir}
+	if err := keySet.Reload(); err != nil {
+		return nil, err
+	}
+	return keySet, nil
+}
+
+// Reload rereads the key directory. On error the keys loaded before are kept.
+func (k *KeySet) Reload() error {
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	keys := make(map[string]*key)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), privateKeySuffix) {
+			continue
+		}
+		loaded, err := loadKey(filepath.Join(k.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		// A private key wins over the public half of the same key
+		if existing, ok := keys[loaded.id]; !ok || existing.private == nil {
+			keys[loaded.id] = loaded
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.signer = pickSigner(keys, time.Now())
+	return nil
+}
+
+// ReloadEvery rereads the key directory at the given interval until stop is
+// closed, so keys added or removed by a rotation are picked up
+func (k *KeySet) ReloadEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := k.Reload(); err != nil {
+				log.Printf("Failed to reload signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// HasSigningKey tells whether the set holds a key to sign tokens with
+func (k *KeySet) HasSigningKey() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.signer != nil
+}
+
+// Sign signs claims with the current signing key, naming it in the kid header
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	signer := k.signer
+	k.mu.RUnlock()
+	if signer == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(signer.method, claims)
+	token.Header["kid"] = signer.id
+	return token.SignedString(signer.private)
+}
+
+// Verify checks the signature and expiry of a token against the key named by
+// its kid header, and returns its claims
+func (k *KeySet) Verify(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, k.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// keyFunc finds the public key a token was signed with
+func (k *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k.mu.RLock()
+	verifier, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	// The algorithm must be the key's own, whatever the header claims
+	if token.Method.Alg() != verifier.method.Alg() {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+	return verifier.public, nil
+}
+
+// pickSigner chooses the newest private key that has been around for the
+// activation delay, or the newest one if none has
+func pickSigner(keys map[string]*key, now time.Time) *key {
+	var private []*key
+	for _, candidate := range keys {
+		if candidate.private != nil {
+			private = append(private, candidate)
+		}
+	}
+	if len(private) == 0 {
+		return nil
+	}
+
+	sort.Slice(private, func(i, j int) bool {
+		if !private[i].loadedAt.Equal(private[j].loadedAt) {
+			return private[i].loadedAt.After(private[j].loadedAt)
+		}
+		return private[i].id > private[j].id
+	})
+	for _, candidate := range private {
+		if !candidate.loadedAt.After(now.Add(-ActivationDelay)) {
+			return candidate
+		}
+	}
+	return private[0]
+}
+
+// loadKey reads a private or public key file
+func loadKey(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s is not PEM encoded", path)
+	}
+
+	name := filepath.Base(path)
+	loaded := &key{loadedAt: info.ModTime()}
+	if strings.HasSuffix(name, publicKeySuffix) {
+		loaded.id = strings.TrimSuffix(name, publicKeySuffix)
+		loaded.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	} else {
+		loaded.id = strings.TrimSuffix(name, privateKeySuffix)
+		loaded.private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %s: %w", path, err)
+	}
+
+	switch private := loaded.private.(type) {
+	case *rsa.PrivateKey:
+		loaded.public = &private.PublicKey
+	case ed25519.PrivateKey:
+		loaded.public = private.Public()
+	case nil:
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", path, loaded.private)
+	}
+
+	switch loaded.public.(type) {
+	case *rsa.PublicKey:
+		loaded.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		loaded.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", path, loaded.public)
+	}
+	return loaded, nil
+}
@@ -0,0 +1,141 @@
+package jwtkeys
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPickSigner(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	private := func(id string, age time.Duration) *key {
+		return &key{id: id, private: struct{}{}, loadedAt: now.Add(-age)}
+	}
+	public := func(id string, age time.Duration) *key {
+		return &key{id: id, loadedAt: now.Add(-age)}
+	}
+
+	tests := []struct {
+		name string
+		keys []*key
+		want string
+	}{
+		{"no keys", nil, ""},
+		{"only public keys", []*key{public("a", time.Hour)}, ""},
+		{"single active key", []*key{private("a", time.Hour)}, "a"},
+		{"single new key", []*key{private("a", time.Second)}, "a"},
+		{"new key waits for activation", []*key{private("old", time.Hour), private("new", time.Minute)}, "old"},
+		{"new key activates after the delay", []*key{private("old", time.Hour), private("new", ActivationDelay)}, "new"},
+		{"newest active key wins", []*key{private("a", 3*time.Hour), private("b", 2*time.Hour), private("c", time.Minute)}, "b"},
+		{"newest key when none is active", []*key{private("a", 2*time.Second), private("b", time.Second)}, "b"},
+		{"public keys never sign", []*key{private("a", time.Hour), public("b", 2*ActivationDelay)}, "a"},
+		{"ties break by key ID", []*key{private("a", time.Hour), private("b", time.Hour)}, "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := make(map[string]*key)
+			for _, k := range tt.keys {
+				keys[k.id] = k
+			}
+
+			got := ""
+			if signer := pickSigner(keys, now); signer != nil {
+				got = signer.id
+			}
+			if got != tt.want {
+				t.Errorf("pickSigner = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsMismatchedKeys(t *testing.T) {
+	dir := t.TempDir()
+	edKID, err := Generate(dir, jwt.SigningMethodEdDSA.Alg())
+	if err != nil {
+		t.Fatalf("Generate EdDSA: %v", err)
+	}
+	rsaKID, err := Generate(dir, jwt.SigningMethodRS256.Alg())
+	if err != nil {
+		t.Fatalf("Generate RS256: %v", err)
+	}
+	keys, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	edKey, rsaKey := keys.keys[edKID], keys.keys[rsaKID]
+
+	claims := jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+	sign := func(method jwt.SigningMethod, kid string, claims jwt.MapClaims, signingKey interface{}) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(signingKey)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return signed
+	}
+
+	valid, err := keys.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if _, err := keys.Verify(valid); err != nil {
+		t.Fatalf("Verify of a token we signed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{
+			name:    "RS256 token naming an Ed25519 key",
+			token:   sign(jwt.SigningMethodRS256, edKID, claims, rsaKey.private),
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "EdDSA token naming an RSA key",
+			token:   sign(jwt.SigningMethodEdDSA, rsaKID, claims, edKey.private),
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "HS256 token keyed with a public key",
+			token:   sign(jwt.SigningMethodHS256, rsaKID, claims, []byte("-----BEGIN PUBLIC KEY-----")),
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "unsigned token",
+			token:   sign(jwt.SigningMethodNone, edKID, claims, jwt.UnsafeAllowNoneSignatureType),
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "unknown key ID",
+			token:   sign(jwt.SigningMethodEdDSA, "unknown", claims, edKey.private),
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "no key ID",
+			token:   sign(jwt.SigningMethodEdDSA, "", claims, edKey.private),
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "no expiry",
+			token:   sign(jwt.SigningMethodEdDSA, edKID, jwt.MapClaims{"sub": "alice"}, edKey.private),
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := keys.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify = %v, %v; want %v", claims, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,17 +2,23 @@ package middlewares
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/c0sm0thecoder/cli-chat-app/internal/jwtkeys"
 )
 
-// JWTMiddleware validates JWT tokens for protected routes
-func JWTMiddleware(secretKey string) func(http.Handler) http.Handler {
+// SessionChecker tells whether the login session of an access token is still
+// active
+type SessionChecker interface {
+	IsSessionActive(userID, sessionID string) (bool, error)
+}
+
+// JWTMiddleware validates JWT tokens for protected routes against the
+// signing keys, refusing tokens whose session has been revoked
+func JWTMiddleware(keys *jwtkeys.KeySet, sessions SessionChecker) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get token from Authorization header
@@ -37,36 +43,14 @@ func JWTMiddleware(secretKey string) func(http.Handler) http.Handler {
 			// Debug logging
 			log.Printf("Processing token: %s", tokenString[:10] + "...")
 
-			// Parse and validate the token
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				// Validate the signing method
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return []byte(secretKey), nil
-			})
-
+			// Verify the token with the key named in its header and extract claims
+			claims, err := keys.Verify(tokenString)
 			if err != nil {
 				log.Printf("JWT Parse error: %v", err)
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
-			// Check if the token is valid
-			if !token.Valid {
-				log.Println("Invalid token")
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-
-			// Extract claims
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				log.Println("Failed to extract claims")
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-
 			// Check if token is expired
 			if exp, ok := claims["exp"].(float64); ok {
 				if time.Now().Unix() > int64(exp) {
@@ -84,11 +68,26 @@ func JWTMiddleware(secretKey string) func(http.Handler) http.Handler {
 				return
 			}
 
+			// Refuse tokens of a revoked session, even before they expire
+			sessionID, _ := claims["sid"].(string)
+			active, err := sessions.IsSessionActive(userID, sessionID)
+			if err != nil {
+				log.Printf("Session check error: %v", err)
+				http.Error(w, "Failed to check session", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				log.Printf("Session revoked for user: %s", userID)
+				http.Error(w, "Session revoked", http.StatusUnauthorized)
+				return
+			}
+
 			// Log successful authentication
 			log.Printf("Authenticated user: %s", userID)
 
-			// Add user ID to request context
+			// Add user ID and session ID to request context
 			ctx := context.WithValue(r.Context(), "userID", userID)
+			ctx = context.WithValue(ctx, "sessionID", sessionID)
 			
 			// Call the next handler with the updated context
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoginChallenge is a login whose password was right, waiting for the second
+// factor. It keeps the device the login came from for the session it starts.
+// Only a hash of its token is stored.
+type LoginChallenge struct {
+	ID            string    `gorm:"type:uuid;primaryKey"`
+	UserID        string    `gorm:"type:varchar(255);not null;index"`
+	TokenHash     string    `gorm:"size:64;uniqueIndex;not null"`
+	DeviceLabel   string    `gorm:"size:100"`
+	ClientVersion string    `gorm:"size:50"`
+	IPAddress     string    `gorm:"size:64"`
+	Attempts      int       `gorm:"not null;default:0"` // Codes tried so far
+	ExpiresAt     time.Time `gorm:"not null"`
+	UsedAt        *time.Time
+	CreatedAt     time.Time
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (c *LoginChallenge) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
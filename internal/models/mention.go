@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Mention records that a message mentioned a user with @username
+type Mention struct {
+	ID          string    `gorm:"type:uuid;primaryKey" json:"id"`
+	MessageID   string    `gorm:"type:uuid;not null;uniqueIndex:idx_mentions_message_user" json:"message_id"`
+	RoomID      string    `gorm:"type:uuid;not null" json:"room_id"`
+	UserID      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_mentions_message_user;index:idx_mentions_user_created,priority:1" json:"user_id"`
+	MentionedBy string    `gorm:"type:varchar(255);not null" json:"mentioned_by"`
+	CreatedAt   time.Time `gorm:"index:idx_mentions_user_created,priority:2" json:"created_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (m *Mention) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -8,12 +8,30 @@ import (
 )
 
 type Message struct {
-	ID        string    `gorm:"type:uuid;primaryKey"`
-	RoomID    string    `gorm:"type:uuid;not null;index"`
-	SenderID  string    `gorm:"type:varchar(255);not null;index"`
-	Content   string    `gorm:"type:text;not null"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        string         `gorm:"type:uuid;primaryKey;index:idx_messages_room_created,priority:3" json:"id"`
+	RoomID    string         `gorm:"type:uuid;not null;index;index:idx_messages_room_created,priority:1" json:"room_id"`
+	Seq       int64          `gorm:"not null;default:0" json:"seq"` // Position in the room, counting from 1
+	SenderID  string         `gorm:"type:varchar(255);not null;index" json:"sender_id"`
+	ParentID  *string        `gorm:"type:uuid;index" json:"parent_id,omitempty"`
+	Content   string         `gorm:"type:text;not null" json:"content"`
+	EditedAt  *time.Time     `json:"edited_at,omitempty"`
+	DeletedBy string         `gorm:"type:varchar(255)" json:"deleted_by,omitempty"`
+	CreatedAt time.Time      `gorm:"index:idx_messages_room_created,priority:2" json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+
+	// ReplyCount is the number of replies in the message's thread
+	ReplyCount int `gorm:"-" json:"reply_count"`
+	// Reactions aggregates the emoji reactions to the message
+	Reactions []ReactionCount `gorm:"-" json:"reactions,omitempty"`
+}
+
+// MessageTombstone replaces the content of deleted messages
+const MessageTombstone = "This message was deleted"
+
+// IsDeleted reports whether the message has been soft-deleted
+func (m *Message) IsDeleted() bool {
+	return m.DeletedAt.Valid
 }
 
 // BeforeCreate will set a UUID rather than numeric ID
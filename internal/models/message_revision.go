@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MessageRevision keeps the content a message had before it was edited
+type MessageRevision struct {
+	ID        string    `gorm:"type:uuid;primaryKey" json:"id"`
+	MessageID string    `gorm:"type:uuid;not null;index" json:"message_id"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	EditedBy  string    `gorm:"type:varchar(255);not null" json:"edited_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (r *MessageRevision) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
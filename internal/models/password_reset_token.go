@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PasswordResetToken lets whoever holds it set a new password for a user,
+// once and until it expires. Only a hash of the token is stored.
+type PasswordResetToken struct {
+	ID        string     `gorm:"type:uuid;primaryKey"`
+	UserID    string     `gorm:"type:varchar(255);not null;index"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Set once the token has reset the password, or was superseded
+	CreatedAt time.Time
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (t *PasswordResetToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Reaction records that a user reacted to a message with an emoji shortcode
+type Reaction struct {
+	MessageID string    `gorm:"type:uuid;primaryKey" json:"message_id"`
+	UserID    string    `gorm:"type:varchar(255);primaryKey" json:"user_id"`
+	Emoji     string    `gorm:"size:32;primaryKey" json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionCount aggregates the reactions to a message for one emoji
+type ReactionCount struct {
+	Emoji string   `json:"emoji"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ReadReceipt records the last message a user has read in a room
+type ReadReceipt struct {
+	RoomID            string    `gorm:"type:uuid;primaryKey" json:"room_id"`
+	UserID            string    `gorm:"type:varchar(255);primaryKey" json:"user_id"`
+	LastReadMessageID string    `gorm:"type:uuid;not null" json:"last_read_message_id"`
+	LastReadAt        time.Time `gorm:"not null" json:"last_read_at"` // Creation time of the last read message
+	UpdatedAt         time.Time `json:"updated_at"`
+}
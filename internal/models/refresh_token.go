@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshToken can be exchanged once for a new access token and a new refresh
+// token. Tokens issued from the same login share a family, the ID of its
+// Session, so reusing a spent token revokes every token of its login. Only a
+// hash of the token is stored.
+type RefreshToken struct {
+	ID        string     `gorm:"type:uuid;primaryKey"`
+	FamilyID  string     `gorm:"type:uuid;not null;index"`
+	UserID    string     `gorm:"type:varchar(255);not null;index"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Set once the token has been exchanged
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -7,12 +7,30 @@ import (
 	"gorm.io/gorm"
 )
 
+// Kinds of rooms
+const (
+	RoomKindGroup  = "room"   // A room people join with its code or an invite
+	RoomKindDirect = "direct" // A conversation between two users
+)
+
 type Room struct {
-	ID        string    `gorm:"type:uuid;primaryKey"`
-	Name      string    `gorm:"size:100;not null"`
-	Code      string    `gorm:"size:12;uniqueIndex;not null"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID         string     `gorm:"type:uuid;primaryKey"`
+	Name       string     `gorm:"size:100;not null"`
+	Topic      string     `gorm:"size:500;not null;default:''"`
+	Code       string     `gorm:"size:12;uniqueIndex;not null"`
+	Private    bool       `gorm:"not null;default:false"` // Joining needs an invite
+	Kind       string     `gorm:"size:16;not null;default:room"`
+	DirectKey  *string    `gorm:"size:120;uniqueIndex"` // Identifies the pair of users of a direct conversation
+	ArchivedAt *time.Time // Archived rooms are read-only and hidden from room listings
+	LastSeq    int64      `gorm:"not null;default:0"` // Sequence number of the room's latest message or change
+	ChangeSeq  int64      `gorm:"not null;default:0"` // Sequence number of the room's latest change other than a new message
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Archived reports whether the room has been archived
+func (r *Room) Archived() bool {
+	return r.ArchivedAt != nil
 }
 
 // BeforeCreate will set a UUID rather than numeric ID
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RoomBan keeps a user out of a room; banned users cannot rejoin by code or invite
+type RoomBan struct {
+	RoomID    string    `gorm:"type:uuid;primaryKey" json:"room_id"`
+	UserID    string    `gorm:"type:varchar(255);primaryKey" json:"user_id"`
+	BannedBy  string    `gorm:"type:varchar(255);not null" json:"banned_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
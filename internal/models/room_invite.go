@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RoomInvite lets whoever holds its token join a room, until it expires, is
+// used up or is revoked
+type RoomInvite struct {
+	ID        string     `gorm:"type:uuid;primaryKey" json:"id"`
+	RoomID    string     `gorm:"type:uuid;not null;index" json:"room_id"`
+	Token     string     `gorm:"size:64;uniqueIndex;not null" json:"token"`
+	CreatedBy string     `gorm:"type:varchar(255);not null" json:"created_by"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	MaxUses   int        `gorm:"not null;default:0" json:"max_uses"` // 0 means unlimited
+	Uses      int        `gorm:"not null;default:0" json:"uses"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (i *RoomInvite) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// Usable reports whether the invite can still be used to join its room
+func (i *RoomInvite) Usable(now time.Time) bool {
+	if i.RevokedAt != nil || !now.Before(i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Roles a user can have in a room
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// RoomMember records that a user belongs to a room and with which role
+type RoomMember struct {
+	RoomID     string     `gorm:"type:uuid;primaryKey" json:"room_id"`
+	UserID     string     `gorm:"type:varchar(255);primaryKey;index" json:"user_id"`
+	Role       string     `gorm:"size:16;not null;default:member" json:"role"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"` // The member cannot post until then
+	CreatedAt  time.Time  `json:"joined_at"`
+}
+
+// CanModerate reports whether the member may manage other members' messages
+func (m *RoomMember) CanModerate() bool {
+	return m.Role == RoleOwner || m.Role == RoleAdmin
+}
+
+// Muted reports whether the member is muted at the given time
+func (m *RoomMember) Muted(now time.Time) bool {
+	return m.MutedUntil != nil && now.Before(*m.MutedUntil)
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session is one login of a user on a device. Access tokens carry its ID and
+// its refresh tokens share it as their family, so revoking the session ends
+// every token issued from that login.
+type Session struct {
+	ID            string     `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID        string     `gorm:"type:varchar(255);not null;index" json:"user_id"`
+	DeviceLabel   string     `gorm:"size:100" json:"device_label"`
+	ClientVersion string     `gorm:"size:50" json:"client_version"`
+	IPAddress     string     `gorm:"size:64" json:"ip_address"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastUsedAt    time.Time  `json:"last_used_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	Current       bool       `gorm:"-" json:"current"` // Whether the caller is using this session
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
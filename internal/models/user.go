@@ -7,12 +7,28 @@ import (
 	"gorm.io/gorm"
 )
 
+// DeletedUserID replaces the username of a deleted account wherever its
+// messages and actions remain. Nobody can sign up with it.
+const DeletedUserID = "[deleted]"
+
 type User struct {
-	ID           string `gorm:"type:uuid;primary_key;"`
-	UserName     string `gorm:"uniqueIndex;size:50;not null"`
-	PasswordHash string `gorm:"not null"`
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID           string     `gorm:"type:uuid;primary_key;"`
+	UserName     string     `gorm:"uniqueIndex;size:50;not null"`
+	PasswordHash string     `gorm:"not null"`
+	LastSeenAt   *time.Time // When the user's last WebSocket connection closed
+
+	// Two-factor authentication: the secret is pending until it is verified
+	// with a first code, which sets TOTPEnabledAt
+	TOTPSecret    string     `gorm:"column:totp_secret;size:64"`
+	TOTPEnabledAt *time.Time `gorm:"column:totp_enabled_at"`
+	TOTPLastStep  int64      `gorm:"column:totp_last_step;not null;default:0"` // Time step of the last accepted code, which cannot be used again
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// TwoFactorEnabled reports whether logging in needs a code as well as the password
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
 }
 
 // Set UUID rather than numeric ID
@@ -0,0 +1,76 @@
+// Package notify delivers messages to users outside of the chat, such as
+// password reset tokens. Accounts have no e-mail address or phone number, so
+// the implementations here hand the message to whoever runs the server.
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Notifier delivers account notifications to users
+type Notifier interface {
+	// NotifyPasswordReset delivers a token that resets the user's password
+	// until it expires
+	NotifyPasswordReset(username, token string, expiresAt time.Time) error
+}
+
+// LogNotifier writes notifications to the server log, for local use
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) NotifyPasswordReset(username, token string, expiresAt time.Time) error {
+	log.Printf("Password reset token for %s, valid until %s: %s", username, expiresAt.Format(time.RFC3339), token)
+	return nil
+}
+
+// FileNotifier appends notifications to a file as JSON lines, for local use
+// or for another process to pick up and deliver
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) NotifyPasswordReset(username, token string, expiresAt time.Time) error {
+	return n.append(map[string]interface{}{
+		"type":       "password_reset",
+		"username":   username,
+		"token":      token,
+		"expires_at": expiresAt,
+		"created_at": time.Now(),
+	})
+}
+
+// append writes one notification as a line of JSON
+func (n *FileNotifier) append(notification interface{}) error {
+	line, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// The file holds secrets, so only the server's user may read it
+	file, err := os.OpenFile(n.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open notification file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write notification: %w", err)
+	}
+	return file.Close()
+}
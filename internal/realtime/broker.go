@@ -0,0 +1,135 @@
+package realtime
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Broker distributes room events between server nodes. Every node publishes
+// events to a topic and fans them out to its own WebSocket clients from the
+// handler registered for that topic.
+type Broker interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(topic string, handler func(payload []byte)) error
+	Unsubscribe(topic string) error
+	Close() error
+}
+
+// localBroker delivers events within the current process only
+type localBroker struct {
+	mu       sync.RWMutex
+	handlers map[string]func(payload []byte)
+}
+
+// NewLocalBroker creates an in-process broker, suitable for a single node
+func NewLocalBroker() Broker {
+	return &localBroker{
+		handlers: make(map[string]func(payload []byte)),
+	}
+}
+
+func (b *localBroker) Publish(topic string, payload []byte) error {
+	b.mu.RLock()
+	handler := b.handlers[topic]
+	b.mu.RUnlock()
+
+	if handler != nil {
+		handler(payload)
+	}
+	return nil
+}
+
+func (b *localBroker) Subscribe(topic string, handler func(payload []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = handler
+	return nil
+}
+
+func (b *localBroker) Unsubscribe(topic string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.handlers, topic)
+	return nil
+}
+
+func (b *localBroker) Close() error {
+	return nil
+}
+
+// redisChannelPrefix namespaces the Redis channels used for topics
+const redisChannelPrefix = "chat:"
+
+// redisBroker relays events between nodes through Redis pub/sub
+type redisBroker struct {
+	client   *redis.Client
+	pubsub   *redis.PubSub
+	mu       sync.RWMutex
+	handlers map[string]func(payload []byte)
+}
+
+// NewRedisBroker creates a broker that shares events with every node
+// connected to the same Redis server
+func NewRedisBroker(client *redis.Client) (Broker, error) {
+	if err := client.Ping(ctxRedis).Err(); err != nil {
+		return nil, err
+	}
+
+	b := &redisBroker{
+		client:   client,
+		pubsub:   client.Subscribe(ctxRedis),
+		handlers: make(map[string]func(payload []byte)),
+	}
+	go b.run()
+
+	return b, nil
+}
+
+// run dispatches messages from the shared subscription to topic handlers
+func (b *redisBroker) run() {
+	for msg := range b.pubsub.Channel() {
+		topic := strings.TrimPrefix(msg.Channel, redisChannelPrefix)
+
+		b.mu.RLock()
+		handler := b.handlers[topic]
+		b.mu.RUnlock()
+
+		if handler != nil {
+			handler([]byte(msg.Payload))
+		}
+	}
+}
+
+func (b *redisBroker) Publish(topic string, payload []byte) error {
+	return PublishMessage(b.client, redisChannelPrefix+topic, string(payload))
+}
+
+func (b *redisBroker) Subscribe(topic string, handler func(payload []byte)) error {
+	b.mu.Lock()
+	b.handlers[topic] = handler
+	b.mu.Unlock()
+
+	if err := b.pubsub.Subscribe(ctxRedis, redisChannelPrefix+topic); err != nil {
+		log.Printf("Failed to subscribe to channel %s: %v", redisChannelPrefix+topic, err)
+		return err
+	}
+	return nil
+}
+
+func (b *redisBroker) Unsubscribe(topic string) error {
+	b.mu.Lock()
+	delete(b.handlers, topic)
+	b.mu.Unlock()
+
+	return b.pubsub.Unsubscribe(ctxRedis, redisChannelPrefix+topic)
+}
+
+func (b *redisBroker) Close() error {
+	if err := b.pubsub.Close(); err != nil {
+		return err
+	}
+	return b.client.Close()
+}
@@ -0,0 +1,141 @@
+package realtime
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLocalBrokerDeliversToSubscribedTopic(t *testing.T) {
+	broker := NewLocalBroker()
+	defer broker.Close()
+
+	var got []string
+	if err := broker.Subscribe("room:a", func(payload []byte) {
+		got = append(got, string(payload))
+	}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	if err := broker.Publish("room:a", []byte("hello")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if err := broker.Publish("room:b", []byte("elsewhere")); err != nil {
+		t.Fatalf("Publish to a topic without subscribers: %v", err)
+	}
+
+	if len(got) != 1 || got[0] != "hello" {
+		t.Fatalf("received %q, want [hello]", got)
+	}
+}
+
+func TestLocalBrokerSubscribeReplacesHandler(t *testing.T) {
+	broker := NewLocalBroker()
+	defer broker.Close()
+
+	var first, second int
+	broker.Subscribe("room:a", func([]byte) { first++ })
+	broker.Subscribe("room:a", func([]byte) { second++ })
+	broker.Publish("room:a", []byte("event"))
+
+	if first != 0 || second != 1 {
+		t.Fatalf("first handler got %d events, second %d; want 0 and 1", first, second)
+	}
+}
+
+func TestLocalBrokerUnsubscribe(t *testing.T) {
+	broker := NewLocalBroker()
+	defer broker.Close()
+
+	received := 0
+	broker.Subscribe("room:a", func([]byte) { received++ })
+	broker.Publish("room:a", []byte("before"))
+	if err := broker.Unsubscribe("room:a"); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	broker.Publish("room:a", []byte("after"))
+
+	if received != 1 {
+		t.Fatalf("received %d events, want 1", received)
+	}
+	if err := broker.Unsubscribe("room:a"); err != nil {
+		t.Fatalf("Unsubscribe of a topic without subscribers: %v", err)
+	}
+}
+
+// newTestRedisBroker connects a broker to the server at REDIS_URL, skipping
+// the test when none is configured
+func newTestRedisBroker(t *testing.T) Broker {
+	t.Helper()
+	if os.Getenv("REDIS_URL") == "" {
+		t.Skip("REDIS_URL not set")
+	}
+
+	client, err := GetRedisClient()
+	if err != nil {
+		t.Fatalf("GetRedisClient: %v", err)
+	}
+	broker, err := NewRedisBroker(client)
+	if err != nil {
+		t.Fatalf("NewRedisBroker: %v", err)
+	}
+	t.Cleanup(func() { broker.Close() })
+	return broker
+}
+
+func TestRedisBrokerRelaysBetweenNodes(t *testing.T) {
+	publisher := newTestRedisBroker(t)
+	receiver := newTestRedisBroker(t)
+
+	topic := "test:" + time.Now().Format(time.RFC3339Nano)
+	received := make(chan string, 16)
+	if err := receiver.Subscribe(topic, func(payload []byte) {
+		received <- string(payload)
+	}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	publishUntilReceived(t, publisher, topic, received)
+
+	if err := receiver.Unsubscribe(topic); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	// Let the unsubscription and any events still in flight settle
+	time.Sleep(200 * time.Millisecond)
+	for len(received) > 0 {
+		<-received
+	}
+
+	publisher.Publish(topic, []byte("after"))
+	select {
+	case payload := <-received:
+		t.Fatalf("received %q after unsubscribing", payload)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// publishUntilReceived publishes to a topic until the receiving handler sees
+// the event. Redis confirms subscriptions asynchronously, so the first events
+// may go out before the receiver is listening.
+func publishUntilReceived(t *testing.T, publisher Broker, topic string, received <-chan string) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if err := publisher.Publish(topic, []byte("hello")); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		select {
+		case payload := <-received:
+			if payload != "hello" {
+				t.Fatalf("received %q, want hello", payload)
+			}
+			return
+		case <-ticker.C:
+		case <-deadline:
+			t.Fatal("receiver got no event")
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client represents a WebSocket client connection. Events for the client wait
+// in a bounded queue and are written by its own goroutine, so broadcasts never
+// write to the connection themselves.
+type Client struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	roomID    string
+	userID    string
+	username  string
+	sessionID string // Login session of the access token the client connected with
+
+	send        chan []byte   // Events waiting to be written; nil asks the writer to close
+	done        chan struct{} // Closed when the client is being disconnected
+	closeOnce   sync.Once
+	closeCode   int    // Close frame sent once done is closed
+	closeReason string // Reason in the close frame
+
+	lastTyping time.Time // When the last typing_started frame was relayed
+	lastActive time.Time // When the client last sent a frame, guarded by hub.mu
+	away       bool      // Whether the client reported its user as away, guarded by hub.mu
+}
+
+// newClient creates a client for an upgraded connection
+func newClient(hub *Hub, conn *websocket.Conn, roomID, userID, username, sessionID string) *Client {
+	return &Client{
+		hub:        hub,
+		conn:       conn,
+		roomID:     roomID,
+		userID:     userID,
+		username:   username,
+		sessionID:  sessionID,
+		send:       make(chan []byte, hub.config.SendQueueSize),
+		done:       make(chan struct{}),
+		lastActive: time.Now(),
+	}
+}
+
+// queue adds an event to the client's outbound queue without blocking. A
+// client whose queue is full is not keeping up and is disconnected.
+func (c *Client) queue(payload []byte) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	select {
+	case c.send <- payload:
+	default:
+		log.Printf("Disconnecting %s from room %s: send queue full", c.userID, c.roomID)
+		c.close(websocket.ClosePolicyViolation, "too slow: send queue full")
+	}
+}
+
+// sendJSON encodes a reply to the client and queues it
+func (c *Client) sendJSON(v interface{}) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.queue(payload)
+}
+
+// closeAfterQueued disconnects the client once the events queued so far are written
+func (c *Client) closeAfterQueued() {
+	c.queue(nil)
+}
+
+// close disconnects the client with a close frame giving the reason. The
+// writer sends the frame and closes the connection, which ends the reader.
+func (c *Client) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeReason = reason
+		close(c.done)
+	})
+}
+
+// writePump writes queued events and pings to the connection until the client
+// is closed or a write fails. It is the connection's only writer.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.hub.config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case payload := <-c.send:
+			if payload == nil {
+				c.close(websocket.CloseNormalClosure, "")
+				c.write(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeReason))
+				return
+			}
+			if err := c.write(websocket.TextMessage, payload); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.write(websocket.PingMessage, nil); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-c.done:
+			c.write(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeReason))
+			return
+		}
+	}
+}
+
+// write writes one frame within the hub's write timeout
+func (c *Client) write(messageType int, data []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteTimeout))
+	return c.conn.WriteMessage(messageType, data)
+}
+
+// writeDirect writes an event before the writer has started, such as a
+// replayed message
+func (c *Client) writeDirect(v interface{}) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteTimeout))
+	return c.conn.WriteJSON(v)
+}
+
+// readTimeout is how long the client may stay silent, pongs included
+func (c *Client) readTimeout() time.Duration {
+	return 2 * c.hub.config.PingInterval
+}
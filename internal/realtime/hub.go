@@ -0,0 +1,349 @@
+package realtime
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/jwtkeys"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// defaultSendQueueSize is how many events may wait for a client by default
+	defaultSendQueueSize = 256
+	// defaultWriteTimeout bounds a single write to a client by default
+	defaultWriteTimeout = 10 * time.Second
+	// defaultPingInterval is how often clients are pinged by default
+	defaultPingInterval = 30 * time.Second
+)
+
+// HubConfig tunes how a Hub writes to its clients. Zero fields take the
+// defaults.
+type HubConfig struct {
+	// SendQueueSize is how many events may wait to be written to a client. A
+	// client that falls further behind is disconnected as too slow.
+	SendQueueSize int
+	// WriteTimeout bounds how long writing one frame to a client may take
+	WriteTimeout time.Duration
+	// PingInterval is how often clients are pinged. A client that answers
+	// nothing for two intervals is disconnected.
+	PingInterval time.Duration
+}
+
+// Hub tracks the WebSocket clients connected to this node and fans room and
+// user events out to them. Events go through the broker so that every node,
+// this one included, delivers them to its own clients.
+type Hub struct {
+	config HubConfig
+	broker Broker
+	keys   *jwtkeys.KeySet // Verifies the access tokens clients connect with
+
+	messageSender     MessageSender
+	messageReplayer   MessageReplayer
+	membershipChecker MembershipChecker
+	presenceStore     PresenceStore
+	sessionChecker    SessionChecker
+
+	mu sync.Mutex
+	// Clients by room, and by user for events that follow a user across rooms
+	roomClients map[string][]*Client
+	userClients map[string][]*Client
+
+	// nodeID tells this node's presence reports from those of other nodes
+	nodeID string
+	// Last status across all nodes of each connected user, guarded by mu
+	userStatus map[string]string
+	// Last status of each user on this node reported to the others, guarded by mu
+	localStatus map[string]string
+	// Statuses reported by other nodes, by user and node, guarded by mu
+	remotePresence map[string]map[string]nodePresence
+	// Presence changes waiting to be broadcast in order, and reports waiting
+	// to be published to the other nodes, guarded by mu
+	pendingPresence []presenceChange
+	pendingReports  []nodePresence
+	presenceWake    chan struct{}
+	presenceOnce    sync.Once
+
+	closed chan struct{}
+}
+
+// NewHub creates a hub that shares events with other nodes through broker and
+// accepts access tokens signed with keys. Use NewLocalBroker for a single node.
+func NewHub(broker Broker, keys *jwtkeys.KeySet, config HubConfig) *Hub {
+	if config.SendQueueSize <= 0 {
+		config.SendQueueSize = defaultSendQueueSize
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = defaultWriteTimeout
+	}
+	if config.PingInterval <= 0 {
+		config.PingInterval = defaultPingInterval
+	}
+
+	h := &Hub{
+		config:         config,
+		broker:         broker,
+		keys:           keys,
+		roomClients:    make(map[string][]*Client),
+		userClients:    make(map[string][]*Client),
+		nodeID:         newNodeID(),
+		userStatus:     make(map[string]string),
+		localStatus:    make(map[string]string),
+		remotePresence: make(map[string]map[string]nodePresence),
+		presenceWake:   make(chan struct{}, 1),
+		closed:         make(chan struct{}),
+	}
+	// Without the reports of other nodes, their users look offline here
+	if err := broker.Subscribe(presenceTopic, h.receivePresence); err != nil {
+		log.Printf("Failed to subscribe to presence reports: %v", err)
+	}
+	return h
+}
+
+// newNodeID generates a random ID for a hub
+func newNodeID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(id)
+}
+
+// SetMessageSender registers the handler used for send_message frames
+func (h *Hub) SetMessageSender(sender MessageSender) {
+	h.messageSender = sender
+}
+
+// SetMessageReplayer registers where missed messages are loaded from when a
+// client resumes. Without one, resuming clients are told to resync.
+func (h *Hub) SetMessageReplayer(replayer MessageReplayer) {
+	h.messageReplayer = replayer
+}
+
+// SetMembershipChecker registers the check a user must pass to connect to a
+// room. Without one, any authenticated user may connect.
+func (h *Hub) SetMembershipChecker(checker MembershipChecker) {
+	h.membershipChecker = checker
+}
+
+// SetPresenceStore registers where presence changes are shown and last-seen
+// times are kept. Without one, presence changes are not broadcast.
+func (h *Hub) SetPresenceStore(store PresenceStore) {
+	h.presenceStore = store
+}
+
+// SetSessionChecker registers the check an access token's session must pass
+// to connect. Without one, any valid token may connect.
+func (h *Hub) SetSessionChecker(checker SessionChecker) {
+	h.sessionChecker = checker
+}
+
+// ConnectedClients returns how many WebSocket clients are connected to this node
+func (h *Hub) ConnectedClients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := 0
+	for _, clients := range h.roomClients {
+		count += len(clients)
+	}
+	return count
+}
+
+// Close disconnects every client and releases the broker
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	select {
+	case <-h.closed:
+	default:
+		close(h.closed)
+	}
+	for _, clients := range h.roomClients {
+		for _, client := range clients {
+			client.close(websocket.CloseGoingAway, "server shutting down")
+		}
+	}
+	h.mu.Unlock()
+
+	return h.broker.Close()
+}
+
+// registerClient adds a client to its room and user, subscribing this node to
+// their topics when it is the first local client
+func (h *Hub) registerClient(client *Client) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	roomID, userID := client.roomID, client.userID
+	if len(h.roomClients[roomID]) == 0 {
+		err := h.broker.Subscribe(roomTopic(roomID), func(payload []byte) {
+			h.deliverToRoom(roomID, payload)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(h.userClients[userID]) == 0 {
+		err := h.broker.Subscribe(userTopic(userID), func(payload []byte) {
+			h.deliverToUser(userID, payload)
+		})
+		if err != nil {
+			if len(h.roomClients[roomID]) == 0 {
+				h.broker.Unsubscribe(roomTopic(roomID))
+			}
+			return err
+		}
+	}
+
+	h.roomClients[roomID] = append(h.roomClients[roomID], client)
+	h.userClients[userID] = append(h.userClients[userID], client)
+
+	h.startPresence()
+	h.refreshPresence(userID)
+	return nil
+}
+
+// removeClient removes a client from its room and user
+func (h *Hub) removeClient(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Clean up empty rooms and users and stop listening for their events
+	if detachClient(h.roomClients, client.roomID, client) {
+		if err := h.broker.Unsubscribe(roomTopic(client.roomID)); err != nil {
+			log.Printf("Failed to unsubscribe from room %s: %v", client.roomID, err)
+		}
+	}
+	if detachClient(h.userClients, client.userID, client) {
+		if err := h.broker.Unsubscribe(userTopic(client.userID)); err != nil {
+			log.Printf("Failed to unsubscribe from user %s: %v", client.userID, err)
+		}
+	}
+
+	h.refreshPresence(client.userID)
+}
+
+// detachClient removes a client from one of the client maps and reports
+// whether that left its entry empty
+func detachClient(clientMap map[string][]*Client, key string, client *Client) bool {
+	clients := clientMap[key]
+	for i, c := range clients {
+		if c == client {
+			clientMap[key] = append(clients[:i], clients[i+1:]...)
+			if len(clientMap[key]) == 0 {
+				delete(clientMap, key)
+				return true
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// roomTopic returns the broker topic carrying events for a room
+func roomTopic(roomID string) string {
+	return "room:" + roomID
+}
+
+// userTopic returns the broker topic carrying events addressed to a user
+func userTopic(userID string) string {
+	return "user:" + userID
+}
+
+// publishToRoom encodes an event and publishes it to a room's topic. Every
+// node, including this one, fans it out to its own clients.
+func (h *Hub) publishToRoom(roomID string, payload interface{}) {
+	h.publish(roomTopic(roomID), payload)
+}
+
+// publish encodes an event and publishes it to a broker topic
+func (h *Hub) publish(topic string, payload interface{}) {
+	// Convert to JSON
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	if err := h.broker.Publish(topic, jsonData); err != nil {
+		log.Printf("Failed to publish event to %s: %v", topic, err)
+	}
+}
+
+// deliverToRoom queues an event for all clients in a room connected to this node
+func (h *Hub) deliverToRoom(roomID string, payload []byte) {
+	h.mu.Lock()
+	clients := append([]*Client(nil), h.roomClients[roomID]...)
+	h.mu.Unlock()
+
+	deliver(clients, payload)
+}
+
+// deliverToUser queues an event for all connections of a user on this node.
+// A removal from a room goes only to the user's connections to that room,
+// and a revoked session only to the session's connections, which are then
+// closed.
+func (h *Hub) deliverToUser(userID string, payload []byte) {
+	var event struct {
+		Type      string `json:"type"`
+		RoomID    string `json:"room_id"`
+		SessionID string `json:"session_id"`
+	}
+	if err := json.Unmarshal(payload, &event); err == nil {
+		switch event.Type {
+		case removedFromRoomEvent:
+			h.disconnectFromRoom(userID, event.RoomID, payload)
+			return
+		case sessionRevokedEvent:
+			h.disconnectSession(userID, event.SessionID, payload)
+			return
+		}
+	}
+
+	h.mu.Lock()
+	clients := append([]*Client(nil), h.userClients[userID]...)
+	h.mu.Unlock()
+
+	deliver(clients, payload)
+}
+
+// disconnectFromRoom sends the removal event to a user's clients in a room on
+// this node and closes them once it is written
+func (h *Hub) disconnectFromRoom(userID, roomID string, payload []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range h.roomClients[roomID] {
+		if client.userID == userID {
+			client.queue(payload)
+			client.closeAfterQueued()
+		}
+	}
+}
+
+// disconnectSession sends the revocation event to a user's clients of a
+// session on this node and closes them once it is written
+func (h *Hub) disconnectSession(userID, sessionID string, payload []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range h.userClients[userID] {
+		if client.sessionID == sessionID {
+			client.queue(payload)
+			client.closeAfterQueued()
+		}
+	}
+}
+
+// deliver queues an event for the given clients. Queueing never blocks, so a
+// slow client cannot hold up the others; it is disconnected instead.
+func deliver(clients []*Client, payload []byte) {
+	for _, client := range clients {
+		client.queue(payload)
+	}
+}
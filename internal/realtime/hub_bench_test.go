@@ -0,0 +1,338 @@
+package realtime
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/jwtkeys"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// benchWindow is how many events a benchmark publisher sends before waiting
+// for them to be delivered. It stays below the send queue size: no bounded
+// queue can absorb a publisher that never pauses.
+const benchWindow = 64
+
+// BenchmarkHubFanout publishes events to one room and waits until every
+// client has received them
+func BenchmarkHubFanout(b *testing.B) {
+	for _, clients := range []int{10, 100, 500} {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			hub := newTestHub(b, 1, HubConfig{SendQueueSize: 4 * benchWindow, WriteTimeout: time.Second})
+			for i := 0; i < clients; i++ {
+				hub.connect(0, fmt.Sprintf("reader-%d", i))
+			}
+			hub.waitConnected(clients)
+
+			b.ResetTimer()
+			for i := 1; i <= b.N; i++ {
+				hub.hub.BroadcastSystemMessage(testRoomID(0), "benchmark event", 0)
+				if i%benchWindow == 0 || i == b.N {
+					hub.waitReceived(0, int64(i)*int64(clients))
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(b.N)*float64(clients)/b.Elapsed().Seconds(), "deliveries/s")
+		})
+	}
+}
+
+// BenchmarkHubParallel publishes from many goroutines at once to clients
+// spread over several rooms
+func BenchmarkHubParallel(b *testing.B) {
+	const clients, rooms = 500, 10
+
+	hub := newTestHub(b, rooms, HubConfig{SendQueueSize: 4 * benchWindow, WriteTimeout: time.Second})
+	members := make([]int64, rooms)
+	for i := 0; i < clients; i++ {
+		hub.connect(i%rooms, fmt.Sprintf("reader-%d", i))
+		members[i%rooms]++
+	}
+	hub.waitConnected(clients)
+
+	published := make([]atomic.Int64, rooms)
+	var publishers atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		room := int(publishers.Add(1)-1) % rooms
+		sent := 0
+		for pb.Next() {
+			hub.hub.BroadcastSystemMessage(testRoomID(room), "benchmark event", 0)
+			total := published[room].Add(1)
+			if sent++; sent%benchWindow == 0 && !hub.waitReceived(room, total*members[room]) {
+				return
+			}
+		}
+	})
+	var deliveries int64
+	for room := range published {
+		hub.waitReceived(room, published[room].Load()*members[room])
+		deliveries += published[room].Load() * members[room]
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(deliveries)/b.Elapsed().Seconds(), "deliveries/s")
+}
+
+// TestHubDisconnectsSlowConsumer checks that a client that stops reading is
+// dropped once its send queue fills, while the clients that keep up still get
+// every event
+func TestHubDisconnectsSlowConsumer(t *testing.T) {
+	const readers, maxEvents = 5, 500
+
+	hub := newTestHub(t, 1, HubConfig{SendQueueSize: 4, WriteTimeout: 2 * time.Second})
+	for i := 0; i < readers; i++ {
+		hub.connect(0, fmt.Sprintf("reader-%d", i))
+	}
+	stalled := hub.connectStalled(0, "stalled")
+	hub.waitConnected(readers + 1)
+	stalledClient := hub.client("stalled")
+
+	// Large events fill the stalled client's socket buffers and then its
+	// queue. Waiting for the readers after each event keeps their queues short.
+	dropped := func() bool {
+		select {
+		case <-stalledClient.done:
+			return true
+		default:
+			return false
+		}
+	}
+	payload := strings.Repeat("x", 32*1024)
+	published := 0
+	for published < maxEvents && !dropped() {
+		hub.hub.BroadcastSystemMessage(testRoomID(0), payload, 0)
+		published++
+		if !hub.waitReceived(0, int64(published)*readers) {
+			t.FailNow()
+		}
+	}
+	if !dropped() {
+		t.Fatalf("stalled client still connected after %d events", published)
+	}
+
+	// Reading again within the write timeout lets the writer finish and send
+	// the close frame after the events it had already queued
+	stalled.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var err error
+	for err == nil {
+		_, _, err = stalled.ReadMessage()
+	}
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok {
+		t.Fatalf("stalled client read %v, want a close frame", err)
+	}
+	if closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != "too slow: send queue full" {
+		t.Errorf("stalled client closed with %d %q, want %d %q",
+			closeErr.Code, closeErr.Text, websocket.ClosePolicyViolation, "too slow: send queue full")
+	}
+
+	// The readers keep getting events after the stalled client is gone
+	hub.hub.BroadcastSystemMessage(testRoomID(0), payload, 0)
+	published++
+	if !hub.waitReceived(0, int64(published)*readers) {
+		t.FailNow()
+	}
+	for i, received := range hub.perReader {
+		if got := received.Load(); got != int64(published) {
+			t.Errorf("reader-%d received %d of %d events", i, got, published)
+		}
+	}
+	hub.waitConnected(readers)
+}
+
+// TestHubRemovesClientThatNeverReads checks that a stalled client whose
+// writes time out leaves the hub, and the other clients still get every event
+func TestHubRemovesClientThatNeverReads(t *testing.T) {
+	const readers, events = 3, 200
+
+	hub := newTestHub(t, 1, HubConfig{SendQueueSize: 4, WriteTimeout: 100 * time.Millisecond})
+	for i := 0; i < readers; i++ {
+		hub.connect(0, fmt.Sprintf("reader-%d", i))
+	}
+	hub.connectStalled(0, "stalled")
+	hub.waitConnected(readers + 1)
+
+	payload := strings.Repeat("x", 32*1024)
+	for i := 1; i <= events; i++ {
+		hub.hub.BroadcastSystemMessage(testRoomID(0), payload, 0)
+		if !hub.waitReceived(0, int64(i)*readers) {
+			t.FailNow()
+		}
+	}
+	hub.waitConnected(readers)
+
+	for i, received := range hub.perReader {
+		if got := received.Load(); got != events {
+			t.Errorf("reader-%d received %d of %d events", i, got, events)
+		}
+	}
+}
+
+// testRoomID names a test room
+func testRoomID(room int) string {
+	return fmt.Sprintf("room-%d", room)
+}
+
+// testHub is a hub served over a test HTTP server, with simulated clients
+type testHub struct {
+	tb        testing.TB
+	hub       *Hub
+	keys      *jwtkeys.KeySet
+	server    *httptest.Server
+	received  []atomic.Int64  // Events received by the reading clients of each room
+	perReader []*atomic.Int64 // Events received by each reading client
+	conns     []*websocket.Conn
+	readers   sync.WaitGroup
+}
+
+// newTestHub starts a hub for clients in the given number of rooms and stops
+// it when the test ends
+func newTestHub(tb testing.TB, rooms int, config HubConfig) *testHub {
+	tb.Helper()
+	return newTestNode(tb, NewLocalBroker(), rooms, config)
+}
+
+// newTestNode starts a hub sharing events through broker, as one of several
+// nodes would
+func newTestNode(tb testing.TB, broker Broker, rooms int, config HubConfig) *testHub {
+	tb.Helper()
+
+	// Clients connect with tokens signed by a throwaway key
+	keyDir := tb.TempDir()
+	if _, err := jwtkeys.Generate(keyDir, "EdDSA"); err != nil {
+		tb.Fatalf("Generate: %v", err)
+	}
+	keys, err := jwtkeys.Load(keyDir)
+	if err != nil {
+		tb.Fatalf("Load: %v", err)
+	}
+
+	hub := NewHub(broker, keys, config)
+	th := &testHub{
+		tb:       tb,
+		hub:      hub,
+		keys:     keys,
+		server:   httptest.NewServer(http.HandlerFunc(hub.HandleWebSocket)),
+		received: make([]atomic.Int64, rooms),
+	}
+	tb.Cleanup(th.close)
+	return th
+}
+
+// connect adds a client to a room that reads and counts every event
+func (th *testHub) connect(room int, username string) {
+	conn := th.dial(room, username, nil)
+	received := new(atomic.Int64)
+	th.perReader = append(th.perReader, received)
+	th.readers.Add(1)
+	go func() {
+		defer th.readers.Done()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			received.Add(1)
+			th.received[room].Add(1)
+		}
+	}()
+}
+
+// connectStalled adds a client that does not read until the test does, with
+// a small socket buffer so the server notices within a few megabytes
+func (th *testHub) connectStalled(room int, username string) *websocket.Conn {
+	return th.dial(room, username, func(network, addr string) (net.Conn, error) {
+		conn, err := net.Dial(network, addr)
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetReadBuffer(64 * 1024)
+		}
+		return conn, err
+	})
+}
+
+// dial connects a simulated client to a room
+func (th *testHub) dial(room int, username string, netDial func(network, addr string) (net.Conn, error)) *websocket.Conn {
+	th.tb.Helper()
+	token, err := th.keys.Sign(jwt.MapClaims{
+		"sub": username,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		th.tb.Fatalf("Sign: %v", err)
+	}
+
+	wsURL := url.URL{
+		Scheme:   "ws",
+		Host:     strings.TrimPrefix(th.server.URL, "http://"),
+		RawQuery: url.Values{"room_id": {testRoomID(room)}, "token": {token}}.Encode(),
+	}
+	dialer := websocket.Dialer{NetDial: netDial}
+	conn, _, err := dialer.Dial(wsURL.String(), nil)
+	if err != nil {
+		th.tb.Fatalf("Failed to connect %s: %v", username, err)
+	}
+	th.conns = append(th.conns, conn)
+	return conn
+}
+
+// client returns the hub's client of a user
+func (th *testHub) client(userID string) *Client {
+	th.tb.Helper()
+	th.hub.mu.Lock()
+	defer th.hub.mu.Unlock()
+
+	clients := th.hub.userClients[userID]
+	if len(clients) != 1 {
+		th.tb.Fatalf("%s has %d clients, want 1", userID, len(clients))
+	}
+	return clients[0]
+}
+
+// waitConnected waits until the hub has the given number of clients
+func (th *testHub) waitConnected(clients int) {
+	th.tb.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for th.hub.ConnectedClients() != clients {
+		if time.Now().After(deadline) {
+			th.tb.Fatalf("%d clients connected, want %d", th.hub.ConnectedClients(), clients)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitReceived waits until the reading clients of a room have received want
+// events between them. It reports a failure and returns false when they do
+// not within a minute; it may be called from any goroutine.
+func (th *testHub) waitReceived(room int, want int64) bool {
+	deadline := time.Now().Add(time.Minute)
+	for th.received[room].Load() < want {
+		if time.Now().After(deadline) {
+			th.tb.Errorf("Clients of %s received %d of %d events", testRoomID(room), th.received[room].Load(), want)
+			return false
+		}
+		time.Sleep(50 * time.Microsecond)
+	}
+	return true
+}
+
+// close disconnects the clients and stops the server
+func (th *testHub) close() {
+	if err := th.hub.Close(); err != nil {
+		th.tb.Errorf("Close: %v", err)
+	}
+	for _, conn := range th.conns {
+		conn.Close()
+	}
+	th.readers.Wait()
+	th.server.Close()
+}
@@ -0,0 +1,322 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Presence statuses
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusOffline = "offline"
+)
+
+const (
+	// awayAfter is how long a connection can stay silent before it counts as away
+	awayAfter = 5 * time.Minute
+	// presenceSweepInterval is how often connections are checked for going idle
+	// and each node repeats the statuses of its users to the others
+	presenceSweepInterval = 30 * time.Second
+	// presenceTTL is how long a status reported by another node counts without
+	// being repeated, so the users of a node that went away turn offline
+	presenceTTL = 3 * presenceSweepInterval
+
+	// presenceTopic carries the statuses nodes report for their own users
+	presenceTopic = "presence"
+)
+
+// Presence is a user's status as derived from their WebSocket connections.
+// LastSeen is when they were last active, or when they disconnected.
+type Presence struct {
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// PresenceStore tells in which rooms a user's presence is shown and keeps
+// their last-seen time once they disconnect
+type PresenceStore interface {
+	MemberRoomIDs(userID string) ([]string, error)
+	RecordLastSeen(userID string, at time.Time) error
+}
+
+// presenceChange is a change of a user's status waiting to be broadcast
+type presenceChange struct {
+	userID   string
+	presence Presence
+}
+
+// nodePresence is a user's status on one node, as this node reported it to
+// the others or another node reported it to us
+type nodePresence struct {
+	Node       string    `json:"node"`
+	UserID     string    `json:"user_id"`
+	Status     string    `json:"status"`
+	LastActive time.Time `json:"last_active"`
+	expires    time.Time // When a report from another node stops counting
+}
+
+// GetPresence returns a user's status from their connections to every node.
+// Users without connections are offline with no LastSeen; their last-seen
+// time comes from the PresenceStore.
+func (h *Hub) GetPresence(userID string) Presence {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status, lastActive := h.clusterPresenceOf(userID, time.Now())
+	if status == StatusOffline {
+		return Presence{Status: status}
+	}
+	return Presence{Status: status, LastSeen: &lastActive}
+}
+
+// clusterPresenceOf combines a user's status on this node with the statuses
+// other nodes reported: online if they are online anywhere, away if they are
+// connected but idle everywhere. Expired reports are dropped. h.mu must be
+// held.
+func (h *Hub) clusterPresenceOf(userID string, now time.Time) (string, time.Time) {
+	status, lastActive := h.presenceOf(userID, now)
+	for node, remote := range h.remotePresence[userID] {
+		if now.After(remote.expires) {
+			delete(h.remotePresence[userID], node)
+			continue
+		}
+		if presenceRank(remote.Status) > presenceRank(status) {
+			status = remote.Status
+		}
+		if remote.LastActive.After(lastActive) {
+			lastActive = remote.LastActive
+		}
+	}
+	if len(h.remotePresence[userID]) == 0 {
+		delete(h.remotePresence, userID)
+	}
+	return status, lastActive
+}
+
+// presenceRank orders statuses from offline to online
+func presenceRank(status string) int {
+	switch status {
+	case StatusOnline:
+		return 2
+	case StatusAway:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// presenceOf derives a user's status from their clients on this node: online
+// if any of them is active, away if all are idle or set away. h.mu must be
+// held.
+func (h *Hub) presenceOf(userID string, now time.Time) (string, time.Time) {
+	clients := h.userClients[userID]
+	if len(clients) == 0 {
+		return StatusOffline, time.Time{}
+	}
+
+	status := StatusAway
+	var lastActive time.Time
+	for _, client := range clients {
+		if client.lastActive.After(lastActive) {
+			lastActive = client.lastActive
+		}
+		if !client.away && now.Sub(client.lastActive) < awayAfter {
+			status = StatusOnline
+		}
+	}
+	return status, lastActive
+}
+
+// touchClient records activity on a connection; away is set when the client
+// reports its user as away
+func (h *Hub) touchClient(client *Client, away bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client.lastActive = time.Now()
+	client.away = away
+	h.refreshPresence(client.userID)
+}
+
+// refreshPresence recomputes a user's status after their connections to this
+// node changed. It reports a change of their status here to the other nodes,
+// and queues a presence_changed event if that changes their status across
+// all nodes. h.mu must be held.
+func (h *Hub) refreshPresence(userID string) {
+	now := time.Now()
+	local, lastActive := h.presenceOf(userID, now)
+	reported, ok := h.localStatus[userID]
+	if !ok {
+		reported = StatusOffline
+	}
+	if local != reported {
+		if local == StatusOffline {
+			delete(h.localStatus, userID)
+		} else {
+			h.localStatus[userID] = local
+		}
+		h.reportPresence(userID, local, lastActive)
+	}
+
+	h.updatePresence(userID, now, true)
+}
+
+// updatePresence records a user's status across all nodes, queueing a
+// presence_changed event if it changed and broadcast is set. Only the node
+// whose connections changed broadcasts, so each change is announced once.
+// h.mu must be held.
+func (h *Hub) updatePresence(userID string, now time.Time, broadcast bool) {
+	status, lastActive := h.clusterPresenceOf(userID, now)
+	previous, ok := h.userStatus[userID]
+	if !ok {
+		previous = StatusOffline
+	}
+	if previous == status {
+		return
+	}
+	if status == StatusOffline {
+		delete(h.userStatus, userID)
+	} else {
+		h.userStatus[userID] = status
+	}
+	if !broadcast {
+		return
+	}
+
+	presence := Presence{Status: status}
+	if status == StatusOffline {
+		presence.LastSeen = &now
+	} else {
+		presence.LastSeen = &lastActive
+	}
+
+	// Broadcasting needs the database and the broker, so it happens outside
+	// the lock, in the order the changes were made
+	h.pendingPresence = append(h.pendingPresence, presenceChange{userID: userID, presence: presence})
+	h.wakePresence()
+}
+
+// reportPresence queues a report of a user's status on this node for the
+// other nodes. h.mu must be held.
+func (h *Hub) reportPresence(userID, status string, lastActive time.Time) {
+	h.pendingReports = append(h.pendingReports, nodePresence{
+		Node:       h.nodeID,
+		UserID:     userID,
+		Status:     status,
+		LastActive: lastActive,
+	})
+	h.wakePresence()
+}
+
+// wakePresence tells the presence goroutine there is something to publish
+func (h *Hub) wakePresence() {
+	select {
+	case h.presenceWake <- struct{}{}:
+	default:
+	}
+}
+
+// receivePresence records the status another node reported for one of its
+// users. Reports do not trigger presence_changed events: the reporting node
+// broadcasts those itself.
+func (h *Hub) receivePresence(payload []byte) {
+	var report nodePresence
+	if err := json.Unmarshal(payload, &report); err != nil || report.Node == h.nodeID || report.UserID == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if report.Status == StatusOffline {
+		delete(h.remotePresence[report.UserID], report.Node)
+	} else {
+		if h.remotePresence[report.UserID] == nil {
+			h.remotePresence[report.UserID] = make(map[string]nodePresence)
+		}
+		report.expires = now.Add(presenceTTL)
+		h.remotePresence[report.UserID][report.Node] = report
+	}
+	h.updatePresence(report.UserID, now, false)
+}
+
+// startPresence starts broadcasting presence changes, once
+func (h *Hub) startPresence() {
+	h.presenceOnce.Do(func() {
+		go h.runPresence()
+	})
+}
+
+// runPresence broadcasts queued presence changes and reports, and
+// periodically marks users whose connections went idle as away and repeats
+// the statuses of this node's users to the others, until the hub is closed
+func (h *Hub) runPresence() {
+	ticker := time.NewTicker(presenceSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.closed:
+			return
+		case <-h.presenceWake:
+		case <-ticker.C:
+			h.mu.Lock()
+			now := time.Now()
+			for userID := range h.userClients {
+				h.refreshPresence(userID)
+				status, lastActive := h.presenceOf(userID, now)
+				h.reportPresence(userID, status, lastActive)
+			}
+			// Drop the reports of nodes that stopped repeating them
+			for userID := range h.remotePresence {
+				h.updatePresence(userID, now, false)
+			}
+			h.mu.Unlock()
+		}
+
+		h.mu.Lock()
+		changes, reports := h.pendingPresence, h.pendingReports
+		h.pendingPresence, h.pendingReports = nil, nil
+		h.mu.Unlock()
+
+		for _, report := range reports {
+			h.publish(presenceTopic, report)
+		}
+		for _, change := range changes {
+			h.broadcastPresence(change.userID, change.presence)
+		}
+	}
+}
+
+// broadcastPresence sends a presence_changed event to every room the user is
+// a member of, and keeps their last-seen time when they go offline
+func (h *Hub) broadcastPresence(userID string, presence Presence) {
+	if h.presenceStore == nil {
+		return
+	}
+
+	if presence.Status == StatusOffline {
+		if err := h.presenceStore.RecordLastSeen(userID, *presence.LastSeen); err != nil {
+			log.Printf("Failed to record last seen time of %s: %v", userID, err)
+		}
+	}
+
+	roomIDs, err := h.presenceStore.MemberRoomIDs(userID)
+	if err != nil {
+		log.Printf("Failed to load rooms of %s: %v", userID, err)
+		return
+	}
+
+	for _, roomID := range roomIDs {
+		h.publishToRoom(roomID, map[string]interface{}{
+			"type":      "presence_changed",
+			"room_id":   roomID,
+			"username":  userID,
+			"status":    presence.Status,
+			"last_seen": presence.LastSeen,
+		})
+	}
+}
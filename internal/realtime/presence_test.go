@@ -0,0 +1,215 @@
+package realtime
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// sharedBroker relays events between the hubs of several nodes within the
+// test, as Redis does between servers
+type sharedBroker struct {
+	mu    sync.RWMutex
+	nodes []*sharedBrokerNode
+}
+
+// sharedBrokerNode is one node's connection to a sharedBroker
+type sharedBrokerNode struct {
+	broker   *sharedBroker
+	mu       sync.RWMutex
+	handlers map[string]func(payload []byte)
+}
+
+// node connects another node to the broker
+func (b *sharedBroker) node() Broker {
+	node := &sharedBrokerNode{broker: b, handlers: make(map[string]func(payload []byte))}
+	b.mu.Lock()
+	b.nodes = append(b.nodes, node)
+	b.mu.Unlock()
+	return node
+}
+
+func (n *sharedBrokerNode) Publish(topic string, payload []byte) error {
+	n.broker.mu.RLock()
+	nodes := append([]*sharedBrokerNode(nil), n.broker.nodes...)
+	n.broker.mu.RUnlock()
+
+	for _, node := range nodes {
+		node.mu.RLock()
+		handler := node.handlers[topic]
+		node.mu.RUnlock()
+		if handler != nil {
+			handler(payload)
+		}
+	}
+	return nil
+}
+
+func (n *sharedBrokerNode) Subscribe(topic string, handler func(payload []byte)) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers[topic] = handler
+	return nil
+}
+
+func (n *sharedBrokerNode) Unsubscribe(topic string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.handlers, topic)
+	return nil
+}
+
+func (n *sharedBrokerNode) Close() error {
+	return nil
+}
+
+// oneRoomPresenceStore shows every user's presence in the first test room
+type oneRoomPresenceStore struct{}
+
+func (oneRoomPresenceStore) MemberRoomIDs(userID string) ([]string, error) {
+	return []string{testRoomID(0)}, nil
+}
+
+func (oneRoomPresenceStore) RecordLastSeen(userID string, at time.Time) error {
+	return nil
+}
+
+func TestPresenceAcrossNodes(t *testing.T) {
+	broker := &sharedBroker{}
+	nodeA := newTestNode(t, broker.node(), 1, HubConfig{})
+	nodeB := newTestNode(t, broker.node(), 1, HubConfig{})
+	nodeA.hub.SetPresenceStore(oneRoomPresenceStore{})
+	nodeB.hub.SetPresenceStore(oneRoomPresenceStore{})
+
+	// A member of the room watches alice's presence from node B
+	statuses := watchPresence(t, nodeB.dial(0, "watcher", nil), "alice")
+
+	aliceOnA := nodeA.dial(0, "alice", nil)
+	expectStatus(t, statuses, StatusOnline)
+	waitPresence(t, nodeB, "alice", StatusOnline)
+
+	// A second connection on another node changes nothing
+	aliceOnB := nodeB.dial(0, "alice", nil)
+	waitReports(t, nodeA, "alice", 1)
+	expectNoStatus(t, statuses)
+
+	// Leaving one node keeps alice online on both
+	aliceOnA.Close()
+	waitReports(t, nodeB, "alice", 0)
+	expectNoStatus(t, statuses)
+	for _, node := range []*testHub{nodeA, nodeB} {
+		if status := node.hub.GetPresence("alice").Status; status != StatusOnline {
+			t.Errorf("alice is %s on one node, want online", status)
+		}
+	}
+
+	// Leaving the last one is announced once
+	aliceOnB.Close()
+	expectStatus(t, statuses, StatusOffline)
+	expectNoStatus(t, statuses)
+	waitPresence(t, nodeA, "alice", StatusOffline)
+}
+
+func TestPresenceReportsExpire(t *testing.T) {
+	hub := newTestHub(t, 1, HubConfig{})
+	report, err := json.Marshal(nodePresence{Node: "other", UserID: "alice", Status: StatusAway, LastActive: time.Now()})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	hub.hub.receivePresence(report)
+	if status := hub.hub.GetPresence("alice").Status; status != StatusAway {
+		t.Fatalf("alice is %s, want away as reported", status)
+	}
+
+	// A node that stops repeating its reports no longer counts
+	hub.hub.mu.Lock()
+	remote := hub.hub.remotePresence["alice"]["other"]
+	remote.expires = time.Now().Add(-time.Second)
+	hub.hub.remotePresence["alice"]["other"] = remote
+	hub.hub.mu.Unlock()
+
+	if status := hub.hub.GetPresence("alice").Status; status != StatusOffline {
+		t.Errorf("alice is %s after the report expired, want offline", status)
+	}
+}
+
+// watchPresence reads a connection's presence_changed events about a user
+// and sends their statuses to the returned channel
+func watchPresence(t *testing.T, conn *websocket.Conn, username string) <-chan string {
+	t.Helper()
+	statuses := make(chan string, 16)
+	go func() {
+		for {
+			var event struct {
+				Type     string `json:"type"`
+				Username string `json:"username"`
+				Status   string `json:"status"`
+			}
+			if err := conn.ReadJSON(&event); err != nil {
+				return
+			}
+			if event.Type == "presence_changed" && event.Username == username {
+				statuses <- event.Status
+			}
+		}
+	}()
+	return statuses
+}
+
+// expectStatus waits for the next presence_changed status
+func expectStatus(t *testing.T, statuses <-chan string, want string) {
+	t.Helper()
+	select {
+	case status := <-statuses:
+		if status != want {
+			t.Fatalf("presence_changed to %s, want %s", status, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no presence_changed to %s", want)
+	}
+}
+
+// expectNoStatus checks that no presence_changed event arrives for a while
+func expectNoStatus(t *testing.T, statuses <-chan string) {
+	t.Helper()
+	select {
+	case status := <-statuses:
+		t.Fatalf("unexpected presence_changed to %s", status)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// waitPresence waits until a node sees a user with the given status
+func waitPresence(t *testing.T, node *testHub, userID, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for node.hub.GetPresence(userID).Status != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s is %s, want %s", userID, node.hub.GetPresence(userID).Status, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitReports waits until a node holds reports about a user from the given
+// number of other nodes
+func waitReports(t *testing.T, node *testHub, userID string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		node.hub.mu.Lock()
+		got := len(node.hub.remotePresence[userID])
+		node.hub.mu.Unlock()
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d nodes reported %s, want %d", got, userID, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
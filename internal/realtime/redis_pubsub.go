@@ -19,9 +19,10 @@ func CreateRedisChannel(redisUrl string) *redis.Client {
 }
 
 func PublishMessage(client *redis.Client, channel, message string) error {
-	err := client.Publish(ctxRedis, channel, message)
+	err := client.Publish(ctxRedis, channel, message).Err()
 	if err != nil {
-		log.Fatalf("Error publishing message to Redis: %v", err)
+		log.Printf("Error publishing message to Redis: %v", err)
+		return err
 	}
 	return nil
 }
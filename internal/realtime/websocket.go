@@ -1,13 +1,14 @@
 package realtime
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
 	"github.com/golang-jwt/jwt/v5"
@@ -15,8 +16,6 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-var ctxWS = context.Background()
-
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
@@ -25,18 +24,56 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
-var (
-	// Map to store clients by room
-	roomClients = make(map[string][]*Client)
-	clientMutex = &sync.Mutex{}
+const (
+	// maxFrameSize limits the size of a single inbound WebSocket frame
+	maxFrameSize = 64 * 1024
+	// typingInterval is the shortest time between two relayed typing_started
+	// frames of a client
+	typingInterval = time.Second
+
+	// maxReplay is the most messages replayed to a resuming client; further
+	// behind, it has to reload the room's history instead
+	maxReplay = 500
+
+	// removedFromRoomEvent is the type of the event that ends a user's
+	// connections to a room they were kicked or banned from
+	removedFromRoomEvent = "removed_from_room"
+	// sessionRevokedEvent is the type of the event that ends the connections
+	// of a login session that was revoked
+	sessionRevokedEvent = "session_revoked"
 )
 
-// Client represents a WebSocket client connection
-type Client struct {
-	conn     *websocket.Conn
-	roomID   string
-	userID   string
-	username string
+// inboundFrame is a typed frame sent by a client over the WebSocket
+type inboundFrame struct {
+	Type     string `json:"type"`
+	ClientID string `json:"client_id"`
+	ParentID string `json:"parent_id"`
+	Content  string `json:"content"`
+	Status   string `json:"status"`
+}
+
+// MessageSender persists chat messages on behalf of WebSocket clients
+type MessageSender interface {
+	SendMessage(roomID, senderID, messageContent string) (*models.Message, error)
+	ReplyToMessage(roomID, parentID, senderID, messageContent string) (*models.Message, error)
+}
+
+// MessageReplayer loads what a resuming client missed: the room as it is now,
+// whose ChangeSeq tells whether anything besides new messages happened, and
+// the messages numbered after seq
+type MessageReplayer interface {
+	MessagesAfter(roomID, userID string, seq int64, limit int) (*models.Room, []models.Message, error)
+}
+
+// MembershipChecker tells whether a user belongs to a room
+type MembershipChecker interface {
+	IsMember(roomID, userID string) (bool, error)
+}
+
+// SessionChecker tells whether the login session of an access token is still
+// active
+type SessionChecker interface {
+	IsSessionActive(userID, sessionID string) (bool, error)
 }
 
 func GetRedisClient() (*redis.Client, error) {
@@ -48,7 +85,7 @@ func GetRedisClient() (*redis.Client, error) {
 }
 
 // HandleWebSocket handles WebSocket connections
-func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Extract token from URL query parameters or Authorization header
 	token := r.URL.Query().Get("token")
 	if token == "" {
@@ -59,13 +96,26 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate token and extract user ID
-	userID, username, err := validateToken(token)
+	userID, username, sessionID, err := h.validateToken(token)
 	if err != nil {
 		// Use HTTP error instead of logging
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	// Tokens of a revoked session are refused even before they expire
+	if h.sessionChecker != nil {
+		active, err := h.sessionChecker.IsSessionActive(userID, sessionID)
+		if err != nil {
+			http.Error(w, "Failed to check session", http.StatusInternalServerError)
+			return
+		}
+		if !active {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
 	// Extract room ID from query parameters
 	roomID := r.URL.Query().Get("room_id")
 	if roomID == "" {
@@ -74,6 +124,29 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reconnecting clients pass the sequence number of the last message they have
+	var resumeAfter int64
+	resuming := r.URL.Query().Has("resume_after")
+	if resuming {
+		resumeAfter, err = strconv.ParseInt(r.URL.Query().Get("resume_after"), 10, 64)
+		if err != nil || resumeAfter < 0 {
+			http.Error(w, "Invalid resume_after parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if h.membershipChecker != nil {
+		member, err := h.membershipChecker.IsMember(roomID, userID)
+		if err != nil {
+			http.Error(w, "Failed to check room membership", http.StatusInternalServerError)
+			return
+		}
+		if !member {
+			http.Error(w, "You are not a member of this room", http.StatusForbidden)
+			return
+		}
+	}
+
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -81,125 +154,342 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create new client
-	client := &Client{
-		conn:     conn,
-		roomID:   roomID,
-		userID:   userID,
-		username: username,
+	// Register client; events start queueing from here on
+	client := newClient(h, conn, roomID, userID, username, sessionID)
+	if err := h.registerClient(client); err != nil {
+		conn.Close()
+		return
 	}
 
-	// Register client
-	clientMutex.Lock()
-	roomClients[roomID] = append(roomClients[roomID], client)
-	clientMutex.Unlock()
+	// The writer starts once the missed messages are written, so the events
+	// queued meanwhile follow them
+	if resuming && !h.replayMissed(client, resumeAfter) {
+		client.close(websocket.CloseAbnormalClosure, "")
+		conn.Close()
+		h.removeClient(client)
+		return
+	}
 
-	// Handle client messages
-	go handleClient(client)
+	go client.writePump()
+	go h.handleClient(client)
 }
 
-// validateToken validates the JWT token and extracts the user ID
-func validateToken(tokenString string) (string, string, error) {
-	// Parse the token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(getJWTSecret()), nil
-	})
-
+// validateToken verifies the JWT token with the hub's keys and extracts the
+// user ID and session ID
+func (h *Hub) validateToken(tokenString string) (string, string, string, error) {
+	claims, err := h.keys.Verify(tokenString)
 	if err != nil {
-		return "", "", err
+		return "", "", "", err
 	}
 
-	// Extract claims
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID, ok := claims["sub"].(string)
-		if !ok {
-			return "", "", jwt.ErrTokenInvalidClaims
-		}
-		return userID, userID, nil // Using userID as username for now
+	userID, ok := claims["sub"].(string)
+	if !ok {
+		return "", "", "", jwt.ErrTokenInvalidClaims
 	}
-
-	return "", "", jwt.ErrTokenInvalidClaims
-}
-
-// getJWTSecret retrieves the JWT secret key
-func getJWTSecret() string {
-	// In a real app, this would be fetched from environment or config
-	return os.Getenv("JWT_SECRET")
+	sessionID, _ := claims["sid"].(string) // Missing from tokens issued before sessions
+	return userID, userID, sessionID, nil  // Using userID as username for now
 }
 
-// handleClient manages the WebSocket connection for a client
-func handleClient(client *Client) {
+// handleClient reads the frames of a client until its connection closes
+func (h *Hub) handleClient(client *Client) {
 	defer func() {
 		// Remove client when connection closes
-		client.conn.Close()
-		removeClient(client)
+		client.close(websocket.CloseNormalClosure, "")
+		h.removeClient(client)
 	}()
 
+	// A client that answers neither frames nor pings is gone
+	client.conn.SetReadLimit(maxFrameSize)
+	client.conn.SetReadDeadline(time.Now().Add(client.readTimeout()))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(client.readTimeout()))
+	})
+
 	for {
 		// Read message from client
-		_, _, err := client.conn.ReadMessage()
+		_, data, err := client.conn.ReadMessage()
 		if err != nil {
 			// Clean exit without logging to console
 			break
 		}
+		client.conn.SetReadDeadline(time.Now().Add(client.readTimeout()))
+
+		var frame inboundFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			client.sendJSON(errorFrame("", "invalid frame"))
+			continue
+		}
+
+		// Any frame shows the user is there; heartbeats may say they are away
+		h.touchClient(client, frame.Type == "heartbeat" && frame.Status == StatusAway)
 
-		// For now we're just keeping the connection alive
-		// Message processing would be implemented here if needed
+		switch frame.Type {
+		case "heartbeat":
+		case "send_message":
+			h.handleSendMessage(client, frame)
+		case "typing_started", "typing_stopped":
+			h.handleTyping(client, frame)
+		default:
+			client.sendJSON(errorFrame(frame.ClientID, "unknown frame type: "+frame.Type))
+		}
 	}
 }
 
-// BroadcastMessage sends a message to all clients in a room
-func BroadcastMessage(roomID string, message *models.Message, username string) {
-	clientMutex.Lock()
-	clients := roomClients[roomID]
-	clientMutex.Unlock()
+// handleSendMessage persists a message sent over the WebSocket and acknowledges it
+func (h *Hub) handleSendMessage(client *Client, frame inboundFrame) {
+	if h.messageSender == nil {
+		client.sendJSON(errorFrame(frame.ClientID, "sending messages over WebSocket is not supported"))
+		return
+	}
 
-	// Create message payload
-	payload := map[string]interface{}{
-		"type":       "new_message",
+	var message *models.Message
+	var err error
+	if frame.ParentID != "" {
+		message, err = h.messageSender.ReplyToMessage(client.roomID, frame.ParentID, client.userID, frame.Content)
+	} else {
+		message, err = h.messageSender.SendMessage(client.roomID, client.userID, frame.Content)
+	}
+	if err != nil {
+		client.sendJSON(errorFrame(frame.ClientID, err.Error()))
+		return
+	}
+
+	client.sendJSON(map[string]interface{}{
+		"type":       "ack",
+		"client_id":  frame.ClientID,
 		"id":         message.ID,
+		"seq":        message.Seq,
 		"room_id":    message.RoomID,
 		"sender_id":  message.SenderID,
-		"username":   username,
+		"parent_id":  message.ParentID,
 		"content":    message.Content,
 		"created_at": message.CreatedAt,
-	}
+	})
+}
 
-	// Convert to JSON
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return
+// handleTyping relays a typing indicator to the client's room without storing it
+func (h *Hub) handleTyping(client *Client, frame inboundFrame) {
+	if frame.Type == "typing_started" {
+		if time.Since(client.lastTyping) < typingInterval {
+			return
+		}
+		client.lastTyping = time.Now()
+	} else {
+		client.lastTyping = time.Time{}
 	}
 
-	// Send to all clients in the room
-	for _, client := range clients {
-		err := client.conn.WriteMessage(websocket.TextMessage, jsonData)
+	h.publishToRoom(client.roomID, map[string]interface{}{
+		"type":     frame.Type,
+		"room_id":  client.roomID,
+		"username": client.username,
+	})
+}
+
+// replayMissed writes a resuming client the messages numbered after seq,
+// before its writer starts. Edits, deletions and other changes cannot be
+// replayed as messages, so a client that missed one, or too many messages, is
+// told to reload the room instead. It reports whether the connection is still
+// usable.
+func (h *Hub) replayMissed(client *Client, seq int64) bool {
+	var frames []interface{}
+	var room *models.Room
+	var messages []models.Message
+	var err error
+	if h.messageReplayer != nil {
+		room, messages, err = h.messageReplayer.MessagesAfter(client.roomID, client.userID, seq, maxReplay+1)
 		if err != nil {
-			client.conn.Close()
-			removeClient(client)
+			log.Printf("Failed to load missed messages of room %s: %v", client.roomID, err)
 		}
 	}
-}
 
-// removeClient removes a client from the room
-func removeClient(client *Client) {
-	clientMutex.Lock()
-	defer clientMutex.Unlock()
+	changed := err == nil && room != nil && room.ChangeSeq > seq
+	if h.messageReplayer == nil || err != nil || len(messages) > maxReplay || changed {
+		if changed {
+			// The room's settings may be among the changes
+			frames = append(frames, roomUpdatedEvent(room, ""))
+		}
+		frames = append(frames, map[string]interface{}{
+			"type":    "resync_required",
+			"room_id": client.roomID,
+		})
+	} else {
+		for i := range messages {
+			frames = append(frames, messageEvent(&messages[i], messages[i].SenderID))
+		}
+		frames = append(frames, map[string]interface{}{
+			"type":     "resumed",
+			"room_id":  client.roomID,
+			"replayed": len(messages),
+		})
+	}
 
-	clients := roomClients[client.roomID]
-	for i, c := range clients {
-		if c == client {
-			roomClients[client.roomID] = append(clients[:i], clients[i+1:]...)
-			break
+	for _, frame := range frames {
+		if err := client.writeDirect(frame); err != nil {
+			return false
 		}
 	}
+	return true
+}
+
+// errorFrame builds an error reply for the frame with the given client ID
+func errorFrame(clientID, reason string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "error",
+		"client_id": clientID,
+		"error":     reason,
+	}
+}
+
+// BroadcastMessage sends a message to all clients in a room
+func (h *Hub) BroadcastMessage(roomID string, message *models.Message, username string) {
+	h.publishToRoom(roomID, messageEvent(message, username))
+}
+
+// messageEvent builds the new_message event for a message
+func messageEvent(message *models.Message, username string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "new_message",
+		"id":         message.ID,
+		"seq":        message.Seq,
+		"room_id":    message.RoomID,
+		"sender_id":  message.SenderID,
+		"parent_id":  message.ParentID,
+		"username":   username,
+		"content":    message.Content,
+		"created_at": message.CreatedAt,
+		"edited_at":  message.EditedAt,
+	}
+}
+
+// BroadcastMessageEdited notifies all clients in a room that a message
+// changed. seq is the room's sequence number of the edit.
+func (h *Hub) BroadcastMessageEdited(roomID string, message *models.Message, seq int64) {
+	h.publishToRoom(roomID, map[string]interface{}{
+		"type":      "message_edited",
+		"id":        message.ID,
+		"seq":       seq,
+		"room_id":   message.RoomID,
+		"sender_id": message.SenderID,
+		"content":   message.Content,
+		"edited_at": message.EditedAt,
+	})
+}
+
+// BroadcastMessageDeleted notifies all clients in a room that a message was
+// deleted. seq is the room's sequence number of the deletion.
+func (h *Hub) BroadcastMessageDeleted(roomID string, message *models.Message, seq int64) {
+	h.publishToRoom(roomID, map[string]interface{}{
+		"type":       "message_deleted",
+		"id":         message.ID,
+		"seq":        seq,
+		"room_id":    message.RoomID,
+		"deleted_by": message.DeletedBy,
+	})
+}
+
+// BroadcastReactionUpdated sends the new reaction counts of a message to all
+// clients in a room. seq is the room's sequence number of the change.
+func (h *Hub) BroadcastReactionUpdated(roomID, messageID string, reactions []models.ReactionCount, seq int64) {
+	h.publishToRoom(roomID, map[string]interface{}{
+		"type":       "reaction_updated",
+		"seq":        seq,
+		"room_id":    roomID,
+		"message_id": messageID,
+		"reactions":  reactions,
+	})
+}
+
+// BroadcastRoomUpdated tells a room that its name, topic, code or settings
+// changed
+func (h *Hub) BroadcastRoomUpdated(room *models.Room, updatedBy string) {
+	h.publishToRoom(room.ID, roomUpdatedEvent(room, updatedBy))
+}
 
-	// Clean up empty rooms
-	if len(roomClients[client.roomID]) == 0 {
-		delete(roomClients, client.roomID)
+// roomUpdatedEvent builds the room_updated event for a room's current
+// settings, numbered with the room's latest change
+func roomUpdatedEvent(room *models.Room, updatedBy string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "room_updated",
+		"seq":         room.ChangeSeq,
+		"room_id":     room.ID,
+		"name":        room.Name,
+		"topic":       room.Topic,
+		"code":        room.Code,
+		"private":     room.Private,
+		"archived_at": room.ArchivedAt,
+		"updated_by":  updatedBy,
 	}
 }
+
+// BroadcastReadReceipt tells a room how far one of its users has read
+func (h *Hub) BroadcastReadReceipt(receipt *models.ReadReceipt) {
+	h.publishToRoom(receipt.RoomID, map[string]interface{}{
+		"type":       "read_receipt",
+		"room_id":    receipt.RoomID,
+		"username":   receipt.UserID,
+		"message_id": receipt.LastReadMessageID,
+		"read_at":    receipt.LastReadAt,
+	})
+}
+
+// BroadcastMention notifies a user that a message mentioned them, wherever
+// they are connected
+func (h *Hub) BroadcastMention(mention *models.Mention, message *models.Message, roomName string) {
+	h.publish(userTopic(mention.UserID), map[string]interface{}{
+		"type":       "mention",
+		"id":         mention.ID,
+		"message_id": message.ID,
+		"room_id":    message.RoomID,
+		"room_name":  roomName,
+		"sender_id":  message.SenderID,
+		"parent_id":  message.ParentID,
+		"content":    message.Content,
+		"created_at": message.CreatedAt,
+	})
+}
+
+// BroadcastDirectMessage tells a user about a new message in one of their
+// direct conversations, wherever they are connected
+func (h *Hub) BroadcastDirectMessage(userID string, message *models.Message) {
+	h.publish(userTopic(userID), map[string]interface{}{
+		"type":       "direct_message",
+		"id":         message.ID,
+		"room_id":    message.RoomID,
+		"sender_id":  message.SenderID,
+		"content":    message.Content,
+		"created_at": message.CreatedAt,
+	})
+}
+
+// BroadcastSystemMessage shows a notice from the server, such as a moderation
+// action, to everyone in a room. It is not stored. seq is the room's sequence
+// number of the change the notice reports, or 0 if it changed nothing clients
+// need to reload.
+func (h *Hub) BroadcastSystemMessage(roomID, content string, seq int64) {
+	h.publishToRoom(roomID, map[string]interface{}{
+		"type":       "system_message",
+		"seq":        seq,
+		"room_id":    roomID,
+		"content":    content,
+		"created_at": time.Now(),
+	})
+}
+
+// DisconnectFromRoom tells a user they were removed from a room and closes
+// their connections to it on every node
+func (h *Hub) DisconnectFromRoom(roomID, userID, reason string) {
+	h.publish(userTopic(userID), map[string]interface{}{
+		"type":    removedFromRoomEvent,
+		"room_id": roomID,
+		"reason":  reason,
+	})
+}
+
+// DisconnectSession tells a session's clients it was revoked and closes their
+// connections on every node
+func (h *Hub) DisconnectSession(userID, sessionID string) {
+	h.publish(userTopic(userID), map[string]interface{}{
+		"type":       sessionRevokedEvent,
+		"session_id": sessionID,
+	})
+}
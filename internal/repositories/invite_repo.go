@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InviteRepository interface {
+	Create(invite *models.RoomInvite) error
+	FindByToken(token string) (*models.RoomInvite, error)
+	FindActiveByRoom(roomID string) ([]models.RoomInvite, error)
+	Consume(roomID, token string) (*models.RoomInvite, error)
+	Revoke(roomID, inviteID string) error
+}
+
+type inviteRepo struct {
+	db *gorm.DB
+}
+
+func NewInviteRepository(db *gorm.DB) InviteRepository {
+	return &inviteRepo{db: db}
+}
+
+func (r *inviteRepo) Create(invite *models.RoomInvite) error {
+	if err := r.db.Create(invite).Error; err != nil {
+		return fmt.Errorf("failed to create invite: %w", err)
+	}
+	return nil
+}
+
+func (r *inviteRepo) FindByToken(token string) (*models.RoomInvite, error) {
+	var invite models.RoomInvite
+	if err := r.db.Where("token = ?", token).First(&invite).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// FindActiveByRoom lists the invites of a room that can still be used, newest first
+func (r *inviteRepo) FindActiveByRoom(roomID string) ([]models.RoomInvite, error) {
+	var invites []models.RoomInvite
+	err := r.db.Where("room_id = ? AND revoked_at IS NULL AND expires_at > ?", roomID, time.Now()).
+		Where("max_uses = 0 OR uses < max_uses").
+		Order("created_at desc").
+		Find(&invites).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find invites: %w", err)
+	}
+	return invites, nil
+}
+
+// Consume uses up one use of an invite to a room. The check and the increment
+// happen in a single statement so concurrent joins cannot exceed max_uses. It
+// returns gorm.ErrRecordNotFound when the room has no such invite or it is no
+// longer usable, without using it up.
+func (r *inviteRepo) Consume(roomID, token string) (*models.RoomInvite, error) {
+	var invite models.RoomInvite
+	result := r.db.Model(&invite).
+		Clauses(clause.Returning{}).
+		Where("token = ? AND room_id = ? AND revoked_at IS NULL AND expires_at > ?", token, roomID, time.Now()).
+		Where("max_uses = 0 OR uses < max_uses").
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to use invite: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &invite, nil
+}
+
+// Revoke stops an invite from being used. It returns gorm.ErrRecordNotFound
+// when the room has no such invite.
+func (r *inviteRepo) Revoke(roomID, inviteID string) error {
+	result := r.db.Model(&models.RoomInvite{}).
+		Where("id = ? AND room_id = ? AND revoked_at IS NULL", inviteID, roomID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke invite: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MentionInboxItem is a mention together with the message and room it points to
+type MentionInboxItem struct {
+	models.Mention
+	ParentID *string `json:"parent_id"`
+	Content  string  `json:"content"`
+	RoomName string  `json:"room_name"`
+	RoomCode string  `json:"room_code"`
+}
+
+type MentionRepository interface {
+	CreateBatch(mentions []models.Mention) error
+	FindByUser(userID string, limit int) ([]MentionInboxItem, error)
+}
+
+type mentionRepo struct {
+	db *gorm.DB
+}
+
+func NewMentionRepository(db *gorm.DB) MentionRepository {
+	return &mentionRepo{db: db}
+}
+
+// CreateBatch stores the mentions of a message, ignoring duplicates
+func (r *mentionRepo) CreateBatch(mentions []models.Mention) error {
+	if len(mentions) == 0 {
+		return nil
+	}
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&mentions).Error; err != nil {
+		return fmt.Errorf("failed to create mentions: %w", err)
+	}
+	return nil
+}
+
+// FindByUser returns the latest mentions of a user, newest first. Mentions in
+// deleted messages are left out.
+func (r *mentionRepo) FindByUser(userID string, limit int) ([]MentionInboxItem, error) {
+	var items []MentionInboxItem
+	err := r.db.Model(&models.Mention{}).
+		Select(`mentions.*, messages.parent_id, messages.content,
+			rooms.name AS room_name, rooms.code AS room_code`).
+		Joins("JOIN messages ON messages.id = mentions.message_id AND messages.deleted_at IS NULL").
+		Joins("JOIN rooms ON rooms.id = mentions.room_id").
+		Where("mentions.user_id = ?", userID).
+		Order("mentions.created_at desc").
+		Limit(limit).
+		Scan(&items).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find mentions: %w", err)
+	}
+	return items, nil
+}
@@ -1,15 +1,60 @@
 package repositories
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// MessageCursor identifies a position in a room's history
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// MessagePageQuery selects a page of a room's history. Without a cursor the
+// latest messages are returned.
+type MessagePageQuery struct {
+	Before *MessageCursor
+	After  *MessageCursor
+	Limit  int
+}
+
+// MessageSearchQuery describes a full-text search over message content.
+// Only messages in rooms UserID is a member of are searched.
+type MessageSearchQuery struct {
+	UserID   string
+	Text     string
+	RoomID   string
+	SenderID string
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+}
+
+// MessageSearchHit is a message matching a search, with the room it belongs to
+type MessageSearchHit struct {
+	models.Message
+	RoomName string  `json:"room_name"`
+	RoomCode string  `json:"room_code"`
+	Rank     float64 `json:"rank"`
+}
+
 type MessageRepository interface {
 	Create(message *models.Message) error
-	FindByRoom(roomID string) ([]models.Message, error)
+	FindByID(messageID string) (*models.Message, error)
+	FindPage(roomID string, query MessagePageQuery) ([]models.Message, bool, error)
+	FindAfterSeq(roomID string, seq int64, limit int) ([]models.Message, error)
+	FindReplies(parentID string) ([]models.Message, error)
+	CountReplies(parentIDs []string) (map[string]int, error)
+	UpdateContent(message *models.Message, revision *models.MessageRevision) error
+	FindRevisions(messageID string) ([]models.MessageRevision, error)
+	Search(query MessageSearchQuery) ([]MessageSearchHit, error)
+	SoftDelete(message *models.Message, deletedBy string) error
 }
 
 type messageRepo struct {
@@ -20,17 +65,235 @@ func NewMessageRepository(db *gorm.DB) MessageRepository {
 	return &messageRepo{db: db}
 }
 
+// MigrateMessageSearch adds the generated tsvector column and GIN index used
+// for full-text search. It is safe to run on every start.
+func MigrateMessageSearch(db *gorm.DB) error {
+	statements := []string{
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (to_tsvector('english', coalesce(content, ''))) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_search_vector ON messages USING GIN (search_vector)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to migrate message search: %w", err)
+		}
+	}
+	return nil
+}
+
+// MigrateMessageSeq numbers the messages stored before sequence numbers
+// existed, in the order they were sent, and adds the index that keeps the
+// numbers unique within a room. It is safe to run on every start.
+func MigrateMessageSeq(db *gorm.DB) error {
+	statements := []string{
+		`UPDATE messages SET seq = numbered.seq
+			FROM (SELECT id, row_number() OVER (PARTITION BY room_id ORDER BY created_at, id) AS seq FROM messages) numbered
+			WHERE messages.id = numbered.id AND messages.seq = 0`,
+		`UPDATE rooms SET last_seq = (SELECT coalesce(max(seq), 0) FROM messages WHERE messages.room_id = rooms.id)
+			WHERE last_seq = 0`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_room_seq ON messages (room_id, seq)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to migrate message sequence numbers: %w", err)
+		}
+	}
+	return nil
+}
+
+// Create stores a message with the next sequence number of its room
 func (r *messageRepo) Create(message *models.Message) error {
-	if err := r.db.Create(message).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Bumping the counter locks the room's row until the message is
+		// stored, so the numbers of a room never repeat or go backwards
+		var room models.Room
+		result := tx.Model(&room).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "last_seq"}}}).
+			Where("id = ?", message.RoomID).
+			UpdateColumn("last_seq", gorm.Expr("last_seq + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		message.Seq = room.LastSeq
+		return tx.Create(message).Error
+	})
+	if err != nil {
 		return fmt.Errorf("failed to create message: %w", err)
 	}
 	return nil
 }
 
-func (r *messageRepo) FindByRoom(roomID string) ([]models.Message, error) {
+// FindAfterSeq returns up to limit messages of a room, replies included,
+// numbered after seq, in order. Deleted messages are left out.
+func (r *messageRepo) FindAfterSeq(roomID string, seq int64, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.db.Where("room_id = ? AND seq > ?", roomID, seq).
+		Order("seq asc").
+		Limit(limit).
+		Find(&messages).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find messages after sequence number: %w", err)
+	}
+	return messages, nil
+}
+
+func (r *messageRepo) FindByID(messageID string) (*models.Message, error) {
+	var message models.Message
+	if err := r.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to find message by ID: %w", err)
+	}
+	return &message, nil
+}
+
+// FindPage returns up to query.Limit top-level messages, oldest first, and
+// whether more messages exist beyond the page in the direction of the query
+func (r *messageRepo) FindPage(roomID string, query MessagePageQuery) ([]models.Message, bool, error) {
+	tx := r.db.Unscoped().Where("room_id = ? AND parent_id IS NULL", roomID)
+
+	// Walk backwards from the newest message unless reading forwards
+	forward := query.After != nil
+	if query.Before != nil {
+		tx = tx.Where("(created_at, id) < (?, ?)", query.Before.CreatedAt, query.Before.ID)
+	}
+	if query.After != nil {
+		tx = tx.Where("(created_at, id) > (?, ?)", query.After.CreatedAt, query.After.ID)
+	}
+	if forward {
+		tx = tx.Order("created_at asc, id asc")
+	} else {
+		tx = tx.Order("created_at desc, id desc")
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	var messages []models.Message
+	if err := tx.Limit(query.Limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to find messages for room: %w", err)
+	}
+
+	hasMore := len(messages) > query.Limit
+	if hasMore {
+		messages = messages[:query.Limit]
+	}
+
+	if !forward {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, hasMore, nil
+}
+
+// FindReplies returns the replies to a message, oldest first
+func (r *messageRepo) FindReplies(parentID string) ([]models.Message, error) {
 	var messages []models.Message
-	if err := r.db.Where("room_id = ?", roomID).Order("created_at asc").Find(&messages).Error; err != nil {
-		return nil, fmt.Errorf("failed to find messages for room: %w", err)
+	if err := r.db.Unscoped().Where("parent_id = ?", parentID).Order("created_at asc").Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to find replies: %w", err)
 	}
 	return messages, nil
 }
+
+// CountReplies returns the number of replies for each of the given messages.
+// Deleted replies count too, as they stay in the thread as tombstones.
+func (r *messageRepo) CountReplies(parentIDs []string) (map[string]int, error) {
+	counts := make(map[string]int, len(parentIDs))
+	if len(parentIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ParentID string
+		Count    int
+	}
+	err := r.db.Unscoped().Model(&models.Message{}).
+		Select("parent_id, count(*) as count").
+		Where("parent_id IN ?", parentIDs).
+		Group("parent_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count replies: %w", err)
+	}
+
+	for _, row := range rows {
+		counts[row.ParentID] = row.Count
+	}
+	return counts, nil
+}
+
+// UpdateContent saves the message's new content together with the revision
+// holding its previous content
+func (r *messageRepo) UpdateContent(message *models.Message, revision *models.MessageRevision) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(revision).Error; err != nil {
+			return err
+		}
+		return tx.Model(message).Updates(map[string]interface{}{
+			"content":   message.Content,
+			"edited_at": message.EditedAt,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+	return nil
+}
+
+func (r *messageRepo) FindRevisions(messageID string) ([]models.MessageRevision, error) {
+	var revisions []models.MessageRevision
+	if err := r.db.Where("message_id = ?", messageID).Order("created_at asc").Find(&revisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to find message revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// SoftDelete marks a message as deleted, recording who deleted it
+func (r *messageRepo) SoftDelete(message *models.Message, deletedBy string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(message).Update("deleted_by", deletedBy).Error; err != nil {
+			return err
+		}
+		return tx.Delete(message).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	message.DeletedBy = deletedBy
+	return nil
+}
+
+// Search finds messages matching a web-style search query, best matches first
+func (r *messageRepo) Search(query MessageSearchQuery) ([]MessageSearchHit, error) {
+	tx := r.db.Model(&models.Message{}).
+		Select(`messages.id, messages.room_id, messages.sender_id, messages.parent_id, messages.content,
+			messages.edited_at, messages.created_at, messages.updated_at,
+			rooms.name AS room_name, rooms.code AS room_code,
+			ts_rank(messages.search_vector, websearch_to_tsquery('english', ?)) AS rank`, query.Text).
+		Joins("JOIN rooms ON rooms.id = messages.room_id").
+		Where("messages.search_vector @@ websearch_to_tsquery('english', ?)", query.Text).
+		Where("messages.room_id IN (?)", r.db.Model(&models.RoomMember{}).Select("room_id").Where("user_id = ?", query.UserID))
+
+	if query.RoomID != "" {
+		tx = tx.Where("messages.room_id = ?", query.RoomID)
+	}
+	if query.SenderID != "" {
+		tx = tx.Where("messages.sender_id = ?", query.SenderID)
+	}
+	if query.From != nil {
+		tx = tx.Where("messages.created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		tx = tx.Where("messages.created_at < ?", *query.To)
+	}
+
+	var hits []MessageSearchHit
+	if err := tx.Order("rank desc, messages.created_at desc").Limit(query.Limit).Scan(&hits).Error; err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	return hits, nil
+}
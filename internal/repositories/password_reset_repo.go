@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"gorm.io/gorm"
+)
+
+type PasswordResetRepository interface {
+	Create(token *models.PasswordResetToken) error
+	FindByHash(tokenHash string) (*models.PasswordResetToken, error)
+	MarkUsed(tokenID string) (bool, error)
+	InvalidateByUser(userID string) error
+}
+
+type passwordResetRepo struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetRepository(db *gorm.DB) PasswordResetRepository {
+	return &passwordResetRepo{db: db}
+}
+
+func (r *passwordResetRepo) Create(token *models.PasswordResetToken) error {
+	if err := r.db.Create(token).Error; err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	return nil
+}
+
+func (r *passwordResetRepo) FindByHash(tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed spends a reset token. The check and the update happen in a single
+// statement, so of two concurrent resets only one reports true.
+func (r *passwordResetRepo) MarkUsed(tokenID string) (bool, error) {
+	result := r.db.Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", tokenID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to use password reset token: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateByUser spends every unused reset token of a user
+func (r *passwordResetRepo) InvalidateByUser(userID string) error {
+	err := r.db.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to invalidate password reset tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReactionRepository interface {
+	Add(reaction *models.Reaction) error
+	Remove(messageID, userID, emoji string) error
+	CountByMessages(messageIDs []string) (map[string][]models.ReactionCount, error)
+}
+
+type reactionRepo struct {
+	db *gorm.DB
+}
+
+func NewReactionRepository(db *gorm.DB) ReactionRepository {
+	return &reactionRepo{db: db}
+}
+
+// Add stores a reaction; reacting twice with the same emoji is a no-op
+func (r *reactionRepo) Add(reaction *models.Reaction) error {
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction).Error; err != nil {
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+	return nil
+}
+
+func (r *reactionRepo) Remove(messageID, userID, emoji string) error {
+	err := r.db.Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&models.Reaction{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	return nil
+}
+
+// CountByMessages aggregates the reactions of each message, keeping emojis in
+// the order they were first used
+func (r *reactionRepo) CountByMessages(messageIDs []string) (map[string][]models.ReactionCount, error) {
+	counts := make(map[string][]models.ReactionCount, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	var reactions []models.Reaction
+	if err := r.db.Where("message_id IN ?", messageIDs).Order("created_at asc").Find(&reactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to find reactions: %w", err)
+	}
+
+	for _, reaction := range reactions {
+		list := counts[reaction.MessageID]
+		found := false
+		for i := range list {
+			if list[i].Emoji == reaction.Emoji {
+				list[i].Count++
+				list[i].Users = append(list[i].Users, reaction.UserID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, models.ReactionCount{
+				Emoji: reaction.Emoji,
+				Count: 1,
+				Users: []string{reaction.UserID},
+			})
+		}
+		counts[reaction.MessageID] = list
+	}
+	return counts, nil
+}
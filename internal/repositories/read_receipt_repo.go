@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UnreadCount is the number of unread messages in one of a user's rooms
+type UnreadCount struct {
+	RoomID            string  `json:"room_id"`
+	RoomName          string  `json:"room_name"`
+	RoomCode          string  `json:"room_code"`
+	LastReadMessageID *string `json:"last_read_message_id"`
+	UnreadCount       int     `json:"unread_count"`
+}
+
+type ReadReceiptRepository interface {
+	Find(roomID, userID string) (*models.ReadReceipt, error)
+	Advance(receipt *models.ReadReceipt) (bool, error)
+	CountUnread(userID string) ([]UnreadCount, error)
+}
+
+type readReceiptRepo struct {
+	db *gorm.DB
+}
+
+func NewReadReceiptRepository(db *gorm.DB) ReadReceiptRepository {
+	return &readReceiptRepo{db: db}
+}
+
+func (r *readReceiptRepo) Find(roomID, userID string) (*models.ReadReceipt, error) {
+	var receipt models.ReadReceipt
+	if err := r.db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&receipt).Error; err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// Advance moves a user's read pointer forward. It reports false, leaving the
+// stored receipt untouched, when the user has already read past the message.
+func (r *readReceiptRepo) Advance(receipt *models.ReadReceipt) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_read_message_id", "last_read_at", "updated_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "read_receipts.last_read_at < excluded.last_read_at"},
+		}},
+	}).Create(receipt)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update read receipt: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountUnread counts the messages others posted after the user's read pointer
+// in every room the user is a member of
+func (r *readReceiptRepo) CountUnread(userID string) ([]UnreadCount, error) {
+	var counts []UnreadCount
+	err := r.db.Raw(`
+		SELECT rooms.id AS room_id, rooms.name AS room_name, rooms.code AS room_code,
+			read_receipts.last_read_message_id,
+			(SELECT count(*) FROM messages
+				WHERE messages.room_id = rooms.id
+				AND messages.deleted_at IS NULL
+				AND messages.sender_id <> ?
+				AND (read_receipts.last_read_at IS NULL OR messages.created_at > read_receipts.last_read_at)
+			) AS unread_count
+		FROM rooms
+		LEFT JOIN read_receipts ON read_receipts.room_id = rooms.id AND read_receipts.user_id = ?
+		WHERE rooms.id IN (SELECT room_id FROM room_members WHERE user_id = ?)
+		ORDER BY rooms.name`, userID, userID, userID).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread messages: %w", err)
+	}
+	return counts, nil
+}
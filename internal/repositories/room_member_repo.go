@@ -0,0 +1,157 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RoomMemberRepository interface {
+	Add(member *models.RoomMember) error
+	Find(roomID, userID string) (*models.RoomMember, error)
+	FindByRoom(roomID string) ([]models.RoomMember, error)
+	FindRoomIDsByUser(userID string) ([]string, error)
+	UpdateRole(roomID, userID, role string) error
+	SetMutedUntil(roomID, userID string, until *time.Time) error
+	Remove(roomID, userID string) error
+	Ban(ban *models.RoomBan) error
+	Unban(roomID, userID string) error
+	FindBan(roomID, userID string) (*models.RoomBan, error)
+	FindBansByRoom(roomID string) ([]models.RoomBan, error)
+}
+
+type roomMemberRepo struct {
+	db *gorm.DB
+}
+
+func NewRoomMemberRepository(db *gorm.DB) RoomMemberRepository {
+	return &roomMemberRepo{db: db}
+}
+
+// MigrateRoomMembers makes everyone who has posted in a room a member of it,
+// so rooms created before memberships existed stay usable. Rooms that already
+// have members are left alone, so kicked users are not added back; it is safe
+// to run on every start.
+func MigrateRoomMembers(db *gorm.DB) error {
+	err := db.Exec(`INSERT INTO room_members (room_id, user_id, role, created_at)
+		SELECT room_id, sender_id, ?, min(created_at) FROM messages
+		WHERE NOT EXISTS (SELECT 1 FROM room_members WHERE room_members.room_id = messages.room_id)
+		AND sender_id <> ?
+		GROUP BY room_id, sender_id
+		ON CONFLICT DO NOTHING`, models.RoleMember, models.DeletedUserID).Error
+	if err != nil {
+		return fmt.Errorf("failed to migrate room members: %w", err)
+	}
+	return nil
+}
+
+// Add stores a membership; joining a room twice keeps the existing role
+func (r *roomMemberRepo) Add(member *models.RoomMember) error {
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(member).Error; err != nil {
+		return fmt.Errorf("failed to add room member: %w", err)
+	}
+	return nil
+}
+
+func (r *roomMemberRepo) Find(roomID, userID string) (*models.RoomMember, error) {
+	var member models.RoomMember
+	if err := r.db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *roomMemberRepo) FindByRoom(roomID string) ([]models.RoomMember, error) {
+	var members []models.RoomMember
+	if err := r.db.Where("room_id = ?", roomID).Order("created_at asc").Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to find room members: %w", err)
+	}
+	return members, nil
+}
+
+func (r *roomMemberRepo) FindRoomIDsByUser(userID string) ([]string, error) {
+	var roomIDs []string
+	if err := r.db.Model(&models.RoomMember{}).Where("user_id = ?", userID).Pluck("room_id", &roomIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to find rooms of member: %w", err)
+	}
+	return roomIDs, nil
+}
+
+func (r *roomMemberRepo) UpdateRole(roomID, userID, role string) error {
+	err := r.db.Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("role", role).Error
+	if err != nil {
+		return fmt.Errorf("failed to update member role: %w", err)
+	}
+	return nil
+}
+
+func (r *roomMemberRepo) SetMutedUntil(roomID, userID string, until *time.Time) error {
+	err := r.db.Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("muted_until", until).Error
+	if err != nil {
+		return fmt.Errorf("failed to update member mute: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes a membership. It returns gorm.ErrRecordNotFound if the user
+// was not a member.
+func (r *roomMemberRepo) Remove(roomID, userID string) error {
+	result := r.db.Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&models.RoomMember{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove room member: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Ban removes a user's membership, if any, and stores the ban in one
+// transaction. Banning a user twice keeps the first ban.
+func (r *roomMemberRepo) Ban(ban *models.RoomBan) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("room_id = ? AND user_id = ?", ban.RoomID, ban.UserID).Delete(&models.RoomMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(ban).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to ban user: %w", err)
+	}
+	return nil
+}
+
+// Unban lifts a ban. It returns gorm.ErrRecordNotFound if the user was not banned.
+func (r *roomMemberRepo) Unban(roomID, userID string) error {
+	result := r.db.Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&models.RoomBan{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unban user: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *roomMemberRepo) FindBan(roomID, userID string) (*models.RoomBan, error) {
+	var ban models.RoomBan
+	if err := r.db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&ban).Error; err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+func (r *roomMemberRepo) FindBansByRoom(roomID string) ([]models.RoomBan, error) {
+	var bans []models.RoomBan
+	if err := r.db.Where("room_id = ?", roomID).Order("created_at desc").Find(&bans).Error; err != nil {
+		return nil, fmt.Errorf("failed to find room bans: %w", err)
+	}
+	return bans, nil
+}
@@ -4,15 +4,41 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// RoomSummary is one of a user's rooms with the user's role and the room's
+// latest top-level message, if any. Peer is the other user of a direct
+// conversation.
+type RoomSummary struct {
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	Topic             string     `json:"topic"`
+	Code              string     `json:"code"`
+	Kind              string     `json:"kind"`
+	Role              string     `json:"role"`
+	Peer              *string    `json:"peer,omitempty"`
+	ArchivedAt        *time.Time `json:"archived_at,omitempty"`
+	LastMessageID     *string    `json:"last_message_id"`
+	LastMessageSender *string    `json:"last_message_sender"`
+	LastMessage       *string    `json:"last_message"`
+	LastMessageAt     *time.Time `json:"last_message_at"`
+}
+
 type RoomRepository interface {
 	Create(room *models.Room) error
+	CreateWithMembers(room *models.Room, members []models.RoomMember) error
 	FindByName(roomName string) (*models.Room, error)
 	FindByCode(roomCode string) (*models.Room, error)
+	FindByID(roomID string) (*models.Room, error)
+	FindByMember(userID, kind string, archived bool) ([]RoomSummary, error)
+	FindByDirectKey(directKey string) (*models.Room, error)
+	Update(room *models.Room) error
+	RecordChange(roomID string) (int64, error)
 }
 
 type roomRepo struct {
@@ -54,3 +80,102 @@ func (r *roomRepo) FindByCode(roomCode string) (*models.Room, error) {
 	}
 	return &room, nil
 }
+
+func (r *roomRepo) FindByID(roomID string) (*models.Room, error) {
+	var room models.Room
+	if err := r.db.Where("id = ?", roomID).First(&room).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to find room by ID: %w", err)
+	}
+	return &room, nil
+}
+
+// Update saves a room's settings. The sequence numbers are left alone; only
+// messageRepo.Create and RecordChange move them.
+func (r *roomRepo) Update(room *models.Room) error {
+	if err := r.db.Omit("last_seq", "change_seq").Save(room).Error; err != nil {
+		return fmt.Errorf("failed to update room: %w", err)
+	}
+	return nil
+}
+
+// RecordChange gives a change of the room other than a new message, such as
+// an edit or a rename, the room's next sequence number and returns it
+func (r *roomRepo) RecordChange(roomID string) (int64, error) {
+	var room models.Room
+	result := r.db.Model(&room).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "last_seq"}}}).
+		Where("id = ?", roomID).
+		UpdateColumns(map[string]interface{}{
+			"last_seq":   gorm.Expr("last_seq + 1"),
+			"change_seq": gorm.Expr("last_seq + 1"),
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to record room change: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return room.LastSeq, nil
+}
+
+// CreateWithMembers creates a room together with its first members
+func (r *roomRepo) CreateWithMembers(room *models.Room, members []models.RoomMember) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(room).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			members[i].RoomID = room.ID
+		}
+		return tx.Create(&members).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create room: %w", err)
+	}
+	return nil
+}
+
+func (r *roomRepo) FindByDirectKey(directKey string) (*models.Room, error) {
+	var room models.Room
+	if err := r.db.Where("direct_key = ?", directKey).First(&room).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to find direct conversation: %w", err)
+	}
+	return &room, nil
+}
+
+// FindByMember lists the rooms of a kind a user belongs to, most recently
+// active first. Archived rooms are listed only when archived is set, and then
+// only they are.
+func (r *roomRepo) FindByMember(userID, kind string, archived bool) ([]RoomSummary, error) {
+	var rooms []RoomSummary
+	err := r.db.Raw(`
+		SELECT rooms.id, rooms.name, rooms.topic, rooms.code, rooms.kind, rooms.archived_at, room_members.role,
+			CASE WHEN rooms.kind = ? THEN (
+				SELECT peers.user_id FROM room_members peers
+				WHERE peers.room_id = rooms.id AND peers.user_id <> room_members.user_id
+				LIMIT 1
+			) END AS peer,
+			last.id AS last_message_id, last.sender_id AS last_message_sender,
+			last.content AS last_message, last.created_at AS last_message_at
+		FROM rooms
+		JOIN room_members ON room_members.room_id = rooms.id AND room_members.user_id = ?
+		LEFT JOIN LATERAL (
+			SELECT id, sender_id, content, created_at FROM messages
+			WHERE messages.room_id = rooms.id AND messages.parent_id IS NULL AND messages.deleted_at IS NULL
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		) last ON true
+		WHERE rooms.kind = ? AND (rooms.archived_at IS NOT NULL) = ?
+		ORDER BY coalesce(last.created_at, room_members.created_at) DESC`, models.RoomKindDirect, userID, kind, archived).
+		Scan(&rooms).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find rooms of member: %w", err)
+	}
+	return rooms, nil
+}
@@ -0,0 +1,123 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"gorm.io/gorm"
+)
+
+type SessionRepository interface {
+	Create(session *models.Session) error
+	FindByID(sessionID string) (*models.Session, error)
+	FindActiveByUser(userID string) ([]models.Session, error)
+	Touch(sessionID string, at time.Time) error
+	Revoke(sessionID string) error
+	RevokeAll(userID, exceptSessionID string) ([]string, error)
+}
+
+type sessionRepo struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepo{db: db}
+}
+
+func (r *sessionRepo) Create(session *models.Session) error {
+	if err := r.db.Create(session).Error; err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (r *sessionRepo) FindByID(sessionID string) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.Where("id = ?", sessionID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// FindActiveByUser returns the sessions of a user that are not revoked, most
+// recently used first
+func (r *sessionRepo) FindActiveByUser(userID string) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Touch records that a session was used at the given time
+func (r *sessionRepo) Touch(sessionID string, at time.Time) error {
+	err := r.db.Model(&models.Session{}).
+		Where("id = ?", sessionID).
+		Update("last_used_at", at).Error
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// Revoke ends a session and every refresh token issued from it
+func (r *sessionRepo) Revoke(sessionID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&models.Session{}).
+			Where("id = ? AND revoked_at IS NULL", sessionID).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+		err = tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", sessionID).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		return nil
+	})
+}
+
+// RevokeAll ends every active session of a user but the given one, which may
+// be empty, with their refresh tokens, and returns the IDs of the revoked
+// sessions
+func (r *sessionRepo) RevokeAll(userID, exceptSessionID string) ([]string, error) {
+	var sessionIDs []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+		if exceptSessionID != "" {
+			query = query.Where("id <> ?", exceptSessionID)
+		}
+		if err := query.Pluck("id", &sessionIDs).Error; err != nil {
+			return fmt.Errorf("failed to find sessions: %w", err)
+		}
+		if len(sessionIDs) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		err := tx.Model(&models.Session{}).
+			Where("id IN ?", sessionIDs).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		err = tx.Model(&models.RefreshToken{}).
+			Where("family_id IN ? AND revoked_at IS NULL", sessionIDs).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessionIDs, nil
+}
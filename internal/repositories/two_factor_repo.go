@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"gorm.io/gorm"
+)
+
+type TwoFactorRepository interface {
+	ReplaceRecoveryCodes(userID string, codeHashes []string) error
+	UseRecoveryCode(userID, codeHash string) (bool, error)
+	CountRecoveryCodes(userID string) (int64, error)
+	DeleteRecoveryCodes(userID string) error
+	CreateChallenge(challenge *models.LoginChallenge) error
+	FindChallengeByHash(tokenHash string) (*models.LoginChallenge, error)
+	RecordAttempt(challengeID string, maxAttempts int) (bool, error)
+	MarkChallengeUsed(challengeID string) (bool, error)
+}
+
+type twoFactorRepo struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorRepository(db *gorm.DB) TwoFactorRepository {
+	return &twoFactorRepo{db: db}
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes for new ones
+func (r *twoFactorRepo) ReplaceRecoveryCodes(userID string, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+		codes := make([]models.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		if err := tx.Create(&codes).Error; err != nil {
+			return fmt.Errorf("failed to create recovery codes: %w", err)
+		}
+		return nil
+	})
+}
+
+// UseRecoveryCode spends one of the user's recovery codes. The check and the
+// update happen in a single statement, so a code works only once.
+func (r *twoFactorRepo) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountRecoveryCodes returns how many of the user's recovery codes are unused
+func (r *twoFactorRepo) CountRecoveryCodes(userID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+func (r *twoFactorRepo) DeleteRecoveryCodes(userID string) error {
+	if err := r.db.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return nil
+}
+
+func (r *twoFactorRepo) CreateChallenge(challenge *models.LoginChallenge) error {
+	if err := r.db.Create(challenge).Error; err != nil {
+		return fmt.Errorf("failed to create login challenge: %w", err)
+	}
+	return nil
+}
+
+func (r *twoFactorRepo) FindChallengeByHash(tokenHash string) (*models.LoginChallenge, error) {
+	var challenge models.LoginChallenge
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&challenge).Error; err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// RecordAttempt counts a code tried against a challenge, reporting false once
+// the challenge has had maxAttempts tries or was used
+func (r *twoFactorRepo) RecordAttempt(challengeID string, maxAttempts int) (bool, error) {
+	result := r.db.Model(&models.LoginChallenge{}).
+		Where("id = ? AND attempts < ? AND used_at IS NULL", challengeID, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record login attempt: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// MarkChallengeUsed completes a challenge; of two concurrent completions only
+// one reports true
+func (r *twoFactorRepo) MarkChallengeUsed(challengeID string) (bool, error) {
+	result := r.db.Model(&models.LoginChallenge{}).
+		Where("id = ? AND used_at IS NULL", challengeID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to complete login challenge: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
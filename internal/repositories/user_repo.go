@@ -3,14 +3,24 @@ package repositories
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
 	Create(user *models.User) error
 	FindByUsername(username string) (*models.User, error)
+	UpdateLastSeen(username string, at time.Time) error
+	FindLastSeen(usernames []string) (map[string]time.Time, error)
+	UpdatePassword(username, passwordHash string) error
+	SetTOTPSecret(username, secret string) error
+	EnableTOTP(username string, step int64) error
+	DisableTOTP(username string) error
+	UseTOTPStep(username string, step int64) (bool, error)
+	Delete(username string) error
 }
 
 type userRepo struct {
@@ -38,3 +48,195 @@ func (r *userRepo) FindByUsername(username string) (*models.User, error) {
 	}
 	return &user, nil
 }
+
+func (r *userRepo) UpdateLastSeen(username string, at time.Time) error {
+	err := r.db.Model(&models.User{}).Where("user_name = ?", username).Update("last_seen_at", at).Error
+	if err != nil {
+		return fmt.Errorf("failed to update last seen time: %w", err)
+	}
+	return nil
+}
+
+// FindLastSeen returns when each of the given users was last seen, leaving
+// out users who have never connected
+func (r *userRepo) FindLastSeen(usernames []string) (map[string]time.Time, error) {
+	var users []models.User
+	err := r.db.Select("user_name", "last_seen_at").
+		Where("user_name IN ? AND last_seen_at IS NOT NULL", usernames).
+		Find(&users).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find last seen times: %w", err)
+	}
+
+	lastSeen := make(map[string]time.Time, len(users))
+	for _, user := range users {
+		lastSeen[user.UserName] = *user.LastSeenAt
+	}
+	return lastSeen, nil
+}
+
+func (r *userRepo) UpdatePassword(username, passwordHash string) error {
+	err := r.db.Model(&models.User{}).Where("user_name = ?", username).Update("password_hash", passwordHash).Error
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+// SetTOTPSecret stores a pending two-factor secret, to be enabled once the
+// user proves their authenticator has it
+func (r *userRepo) SetTOTPSecret(username, secret string) error {
+	err := r.db.Model(&models.User{}).Where("user_name = ?", username).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled_at": nil, "totp_last_step": 0}).Error
+	if err != nil {
+		return fmt.Errorf("failed to store two-factor secret: %w", err)
+	}
+	return nil
+}
+
+// EnableTOTP turns two-factor authentication on, recording the step of the
+// code that proved it works
+func (r *userRepo) EnableTOTP(username string, step int64) error {
+	err := r.db.Model(&models.User{}).Where("user_name = ?", username).
+		Updates(map[string]interface{}{"totp_enabled_at": time.Now(), "totp_last_step": step}).Error
+	if err != nil {
+		return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	return nil
+}
+
+// DisableTOTP turns two-factor authentication off and forgets the secret
+func (r *userRepo) DisableTOTP(username string) error {
+	err := r.db.Model(&models.User{}).Where("user_name = ?", username).
+		Updates(map[string]interface{}{"totp_secret": "", "totp_enabled_at": nil, "totp_last_step": 0}).Error
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	return nil
+}
+
+// UseTOTPStep records that a code of the given time step was accepted. It
+// reports false when a code of that step or a later one was already used, so
+// an intercepted code cannot be replayed.
+func (r *userRepo) UseTOTPStep(username string, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("user_name = ? AND totp_last_step < ?", username, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record two-factor code: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Delete removes a user in one transaction. Their messages, edits, mentions
+// of others, bans and invites stay, attributed to models.DeletedUserID; what
+// only mattered to them (memberships, reactions, receipts, their mentions
+// inbox, bans against them, logins) goes. Rooms they owned pass to their
+// longest-standing admin, or member, or are archived when nobody else is in
+// them. Their direct conversations are archived and detached so a new account
+// with the same name cannot take them over.
+func (r *userRepo) Delete(username string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := transferOwnedRooms(tx, username); err != nil {
+			return err
+		}
+
+		var directRoomIDs []string
+		err := tx.Model(&models.Room{}).
+			Joins("JOIN room_members ON room_members.room_id = rooms.id").
+			Where("rooms.kind = ? AND room_members.user_id = ?", models.RoomKindDirect, username).
+			Pluck("rooms.id", &directRoomIDs).Error
+		if err != nil {
+			return fmt.Errorf("failed to find direct conversations: %w", err)
+		}
+		if len(directRoomIDs) > 0 {
+			err = tx.Model(&models.Room{}).
+				Where("id IN ?", directRoomIDs).
+				Updates(map[string]interface{}{"direct_key": nil, "archived_at": gorm.Expr("COALESCE(archived_at, ?)", time.Now())}).Error
+			if err != nil {
+				return fmt.Errorf("failed to archive direct conversations: %w", err)
+			}
+		}
+
+		anonymize := []struct {
+			model  interface{}
+			column string
+		}{
+			{&models.Message{}, "sender_id"},
+			{&models.Message{}, "deleted_by"},
+			{&models.MessageRevision{}, "edited_by"},
+			{&models.Mention{}, "mentioned_by"},
+			{&models.RoomBan{}, "banned_by"},
+			{&models.RoomInvite{}, "created_by"},
+		}
+		for _, field := range anonymize {
+			err := tx.Unscoped().Model(field.model).
+				Where(field.column+" = ?", username).
+				UpdateColumn(field.column, models.DeletedUserID).Error
+			if err != nil {
+				return fmt.Errorf("failed to anonymize %s: %w", field.column, err)
+			}
+		}
+
+		remove := []interface{}{
+			&models.RoomMember{},
+			&models.Reaction{},
+			&models.ReadReceipt{},
+			&models.Mention{},
+			&models.RoomBan{},
+			&models.RefreshToken{},
+			&models.PasswordResetToken{},
+			&models.RecoveryCode{},
+			&models.LoginChallenge{},
+			&models.Session{},
+		}
+		for _, model := range remove {
+			if err := tx.Where("user_id = ?", username).Delete(model).Error; err != nil {
+				return fmt.Errorf("failed to delete user data: %w", err)
+			}
+		}
+
+		if err := tx.Where("user_name = ?", username).Delete(&models.User{}).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		return nil
+	})
+}
+
+// transferOwnedRooms hands each room the user owns to its longest-standing
+// admin, or member when it has no admin, and archives the rooms left empty
+func transferOwnedRooms(tx *gorm.DB, username string) error {
+	var roomIDs []string
+	err := tx.Model(&models.RoomMember{}).
+		Where("user_id = ? AND role = ?", username, models.RoleOwner).
+		Pluck("room_id", &roomIDs).Error
+	if err != nil {
+		return fmt.Errorf("failed to find owned rooms: %w", err)
+	}
+
+	for _, roomID := range roomIDs {
+		var heir models.RoomMember
+		err := tx.Where("room_id = ? AND user_id <> ?", roomID, username).
+			Order(clause.OrderBy{Expression: clause.Expr{SQL: "role = ? DESC, created_at ASC", Vars: []interface{}{models.RoleAdmin}}}).
+			First(&heir).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = tx.Model(&models.Room{}).
+				Where("id = ? AND archived_at IS NULL", roomID).
+				Update("archived_at", time.Now()).Error
+			if err != nil {
+				return fmt.Errorf("failed to archive empty room: %w", err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find new room owner: %w", err)
+		}
+		err = tx.Model(&models.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, heir.UserID).
+			Update("role", models.RoleOwner).Error
+		if err != nil {
+			return fmt.Errorf("failed to transfer room ownership: %w", err)
+		}
+	}
+	return nil
+}
@@ -1,40 +1,130 @@
 package services
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/c0sm0thecoder/cli-chat-app/internal/jwtkeys"
 	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"github.com/c0sm0thecoder/cli-chat-app/internal/notify"
+	"github.com/c0sm0thecoder/cli-chat-app/internal/realtime"
 	"github.com/c0sm0thecoder/cli-chat-app/internal/repositories"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	gonanoid "github.com/matoous/go-nanoid/v2"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type AuthService interface {
 	SignUp(username, password string) error
-	Login(username, password string) (string, error)
+	Login(username, password string, device DeviceInfo) (*LoginResult, error)
+	CompleteLogin(challenge, code string) (*TokenPair, error)
+	Refresh(refreshToken string) (*TokenPair, error)
+	Logout(refreshToken string) error
+	ListSessions(userID, currentSessionID string) ([]models.Session, error)
+	RevokeSession(userID, sessionID string) error
+	IsSessionActive(userID, sessionID string) (bool, error)
+	ChangePassword(userID, sessionID, oldPassword, newPassword, code string) error
+	RequestPasswordReset(username string) error
+	AdminResetPassword(adminID, username string) error
+	ResetPassword(resetToken, newPassword string) error
+	DeleteAccount(userID, password, code string) error
+	TwoFactorStatus(userID string) (*TwoFactorStatus, error)
+	EnrollTOTP(userID string) (*TOTPEnrollment, error)
+	ActivateTOTP(userID, code string) ([]string, error)
+	DisableTOTP(userID, password, code string) error
 }
 
 type authService struct {
-	userRepo  repositories.UserRepository
-	jwtSecret string
+	userRepo         repositories.UserRepository
+	refreshTokenRepo repositories.RefreshTokenRepository
+	sessionRepo      repositories.SessionRepository
+	resetRepo        repositories.PasswordResetRepository
+	twoFactorRepo    repositories.TwoFactorRepository
+	hub              *realtime.Hub
+	keys             *jwtkeys.KeySet
+	notifier         notify.Notifier
+	admins           map[string]bool
 }
 
 var (
-	ErrUserAlreadyExists  = errors.New("user already exists")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserAlreadyExists   = errors.New("user already exists")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInvalidResetToken   = errors.New("invalid or expired password reset token")
+	ErrEmptyPassword       = errors.New("password cannot be empty")
 )
 
-func NewAuthService(userRepo repositories.UserRepository, jwtSecret string) AuthService {
+const (
+	// AccessTokenTTL is how long an access token is accepted
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token can be exchanged
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// PasswordResetTTL is how long a password reset token can be used
+	PasswordResetTTL = time.Hour
+	// sessionTouchInterval is how stale a session's last-used time may get
+	// before a request updates it
+	sessionTouchInterval = time.Minute
+)
+
+// LoginResult is what the password step of a login returns: the tokens of
+// the new session, or for users with two-factor authentication a challenge to
+// complete with CompleteLogin
+type LoginResult struct {
+	Tokens    *TokenPair
+	Challenge string
+}
+
+// DeviceInfo describes where a login comes from, to tell sessions apart
+type DeviceInfo struct {
+	Label         string // Chosen by the client, such as the host name
+	ClientVersion string
+	IPAddress     string
+}
+
+// TokenPair is what a login or a refresh returns: a short-lived access token
+// for API calls and a single-use refresh token to get the next pair
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds until the access token expires
+}
+
+// NewAuthService creates the auth service. Password reset tokens are
+// delivered through notifier; users listed in admins may start a reset for
+// any user.
+func NewAuthService(userRepo repositories.UserRepository, refreshTokenRepo repositories.RefreshTokenRepository, sessionRepo repositories.SessionRepository, resetRepo repositories.PasswordResetRepository, twoFactorRepo repositories.TwoFactorRepository, hub *realtime.Hub, keys *jwtkeys.KeySet, notifier notify.Notifier, admins []string) AuthService {
+	adminSet := make(map[string]bool, len(admins))
+	for _, admin := range admins {
+		adminSet[admin] = true
+	}
+
 	return &authService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		sessionRepo:      sessionRepo,
+		resetRepo:        resetRepo,
+		twoFactorRepo:    twoFactorRepo,
+		hub:              hub,
+		keys:             keys,
+		notifier:         notifier,
+		admins:           adminSet,
 	}
 }
 
 func (s *authService) SignUp(username, password string) error {
+	// The name of deleted accounts is reserved
+	if username == models.DeletedUserID {
+		return ErrUserAlreadyExists
+	}
+
 	// Check if user already exists
 	existingUser, err := s.userRepo.FindByUsername(username)
 	if err == nil && existingUser != nil {
@@ -56,37 +146,406 @@ func (s *authService) SignUp(username, password string) error {
 	return s.userRepo.Create(user)
 }
 
-func (s *authService) Login(username, password string) (string, error) {
+func (s *authService) Login(username, password string, device DeviceInfo) (*LoginResult, error) {
 	log.Printf("Attempting login for user: %s", username)
 	
 	// Find user by username
 	user, err := s.userRepo.FindByUsername(username)
 	if err != nil {
 		log.Printf("Login error - user not found: %s", username)
-		return "", ErrUserNotFound
+		return nil, ErrUserNotFound
 	}
 
 	// Compare passwords
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
 		log.Printf("Login error - invalid password for user: %s", username)
-		return "", ErrInvalidCredentials
+		return nil, ErrInvalidCredentials
+	}
+
+	// The password is not enough when two-factor authentication is on
+	if user.TwoFactorEnabled() {
+		challenge, err := s.createChallenge(user.UserName, device)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Login for user: %s awaits a two-factor code", username)
+		return &LoginResult{Challenge: challenge}, nil
+	}
+
+	pair, err := s.startSession(user.UserName, device)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Login successful for user: %s, token created", username)
+	return &LoginResult{Tokens: pair}, nil
+}
+
+// startSession starts a new session, whose ID is the family of its refresh
+// tokens, and issues its first tokens
+func (s *authService) startSession(userID string, device DeviceInfo) (*TokenPair, error) {
+	now := time.Now()
+	session := &models.Session{
+		UserID:        userID,
+		DeviceLabel:   truncate(device.Label, 100),
+		ClientVersion: truncate(device.ClientVersion, 50),
+		IPAddress:     truncate(device.IPAddress, 64),
+		CreatedAt:     now,
+		LastUsedAt:    now,
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(userID, session.ID)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// works once; presenting a spent one means it was stolen or replayed, so the
+// whole session is revoked and its holder has to log in again.
+func (s *authService) Refresh(refreshToken string) (*TokenPair, error) {
+	token, err := s.findRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if token.RevokedAt != nil || !time.Now().Before(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	used, err := s.refreshTokenRepo.MarkUsed(token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		log.Printf("Refresh token reused for user: %s, revoking its session", token.UserID)
+		if err := s.endSession(token.UserID, token.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Refresh tokens issued before sessions have none to continue
+	session, err := s.findSession(token.FamilyID)
+	if err != nil {
+		if err == ErrSessionNotFound {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if session.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err := s.sessionRepo.Touch(session.ID, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(token.UserID, token.FamilyID)
+}
+
+// Logout revokes the session the refresh token belongs to, ending the login
+// it came from
+func (s *authService) Logout(refreshToken string) error {
+	token, err := s.findRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	return s.endSession(token.UserID, token.FamilyID)
+}
+
+// ListSessions returns the user's active sessions, marking the one the caller
+// is using
+func (s *authService) ListSessions(userID, currentSessionID string) ([]models.Session, error) {
+	sessions, err := s.sessionRepo.FindActiveByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession logs one of the user's sessions out, wherever it is used
+func (s *authService) RevokeSession(userID, sessionID string) error {
+	session, err := s.findSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID || session.RevokedAt != nil {
+		return ErrSessionNotFound
+	}
+	return s.endSession(userID, sessionID)
+}
+
+// IsSessionActive tells whether an access token's session may still be used,
+// recording the use. Tokens without a session predate sessions and are refused.
+func (s *authService) IsSessionActive(userID, sessionID string) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+	session, err := s.findSession(sessionID)
+	if err != nil {
+		if err == ErrSessionNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if session.UserID != userID || session.RevokedAt != nil {
+		return false, nil
+	}
+
+	if now := time.Now(); now.Sub(session.LastUsedAt) > sessionTouchInterval {
+		if err := s.sessionRepo.Touch(sessionID, now); err != nil {
+			log.Printf("Failed to record use of session %s: %v", sessionID, err)
+		}
+	}
+	return true, nil
+}
+
+// ChangePassword sets a new password after checking the current one, and a
+// two-factor code if the user has two-factor authentication on, and logs out
+// every other session of the user
+func (s *authService) ChangePassword(userID, sessionID, oldPassword, newPassword, code string) error {
+	user, err := s.confirmIdentity(userID, oldPassword, code)
+	if err != nil {
+		return err
+	}
+	if err := s.setPassword(user.UserName, newPassword); err != nil {
+		return err
+	}
+	return s.endSessions(userID, sessionID)
+}
+
+// RequestPasswordReset delivers a reset token to a user. Unknown users are
+// ignored, so the answer does not tell which usernames exist.
+func (s *authService) RequestPasswordReset(username string) error {
+	if _, err := s.userRepo.FindByUsername(username); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Password reset requested for unknown user: %s", username)
+			return nil
+		}
+		return err
+	}
+	return s.sendResetToken(username)
+}
+
+// AdminResetPassword delivers a reset token to a user on an administrator's
+// behalf and logs the user out everywhere, for accounts that may be
+// compromised
+func (s *authService) AdminResetPassword(adminID, username string) error {
+	if !s.admins[adminID] {
+		return ErrForbidden
+	}
+	if _, err := s.userRepo.FindByUsername(username); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	log.Printf("Password reset of %s started by %s", username, adminID)
+	if err := s.endSessions(username, ""); err != nil {
+		return err
+	}
+	return s.sendResetToken(username)
+}
+
+// ResetPassword sets a new password with a reset token. The token works once,
+// other tokens of the user stop working, and every session is logged out.
+func (s *authService) ResetPassword(resetToken, newPassword string) error {
+	if newPassword == "" {
+		return ErrEmptyPassword
+	}
+
+	token, err := s.resetRepo.FindByHash(hashToken(resetToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if token.UsedAt != nil || !time.Now().Before(token.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+	used, err := s.resetRepo.MarkUsed(token.ID)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidResetToken
+	}
+
+	if err := s.setPassword(token.UserID, newPassword); err != nil {
+		return err
+	}
+	if err := s.resetRepo.InvalidateByUser(token.UserID); err != nil {
+		return err
+	}
+	log.Printf("Password reset for user: %s", token.UserID)
+	return s.endSessions(token.UserID, "")
+}
+
+// DeleteAccount deletes the user after checking their password, and a
+// two-factor code if they have two-factor authentication on. Their messages
+// stay in their rooms, attributed to models.DeletedUserID.
+func (s *authService) DeleteAccount(userID, password, code string) error {
+	if _, err := s.confirmIdentity(userID, password, code); err != nil {
+		return err
+	}
+
+	// Close live connections before the sessions disappear with the user
+	sessions, err := s.sessionRepo.FindActiveByUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.Delete(userID); err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		s.hub.DisconnectSession(userID, session.ID)
+	}
+	log.Printf("Account deleted: %s", userID)
+	return nil
+}
+
+// checkPassword returns the user if the password is theirs
+func (s *authService) checkPassword(userID, password string) (*models.User, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// setPassword hashes and stores a new password
+func (s *authService) setPassword(userID, password string) error {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
 	}
+	return s.userRepo.UpdatePassword(userID, string(hashedPassword))
+}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.UserName, // Use username as subject
-		"exp": time.Now().Add(24 * time.Hour).Unix(), // Token expires in 24 hours
-		"iat": time.Now().Unix(),
+// sendResetToken stores a new reset token for a user and delivers it
+func (s *authService) sendResetToken(userID string) error {
+	resetToken, err := gonanoid.New(43)
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	expiresAt := time.Now().Add(PasswordResetTTL)
+	err = s.resetRepo.Create(&models.PasswordResetToken{
+		UserID:    userID,
+		TokenHash: hashToken(resetToken),
+		ExpiresAt: expiresAt,
 	})
+	if err != nil {
+		return err
+	}
+	return s.notifier.NotifyPasswordReset(userID, resetToken, expiresAt)
+}
+
+// endSessions revokes every session of a user but the given one, which may be
+// empty, and closes their WebSocket connections
+func (s *authService) endSessions(userID, exceptSessionID string) error {
+	revoked, err := s.sessionRepo.RevokeAll(userID, exceptSessionID)
+	if err != nil {
+		return err
+	}
+	for _, sessionID := range revoked {
+		s.hub.DisconnectSession(userID, sessionID)
+	}
+	return nil
+}
+
+// findSession looks a session up by ID
+func (s *authService) findSession(sessionID string) (*models.Session, error) {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return nil, ErrSessionNotFound
+	}
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// endSession revokes a session with its refresh tokens and closes its
+// WebSocket connections. Its access tokens are refused from then on.
+func (s *authService) endSession(userID, sessionID string) error {
+	if err := s.sessionRepo.Revoke(sessionID); err != nil {
+		return err
+	}
+	s.hub.DisconnectSession(userID, sessionID)
+	return nil
+}
+
+// findRefreshToken looks a refresh token up by its hash
+func (s *authService) findRefreshToken(refreshToken string) (*models.RefreshToken, error) {
+	token, err := s.refreshTokenRepo.FindByHash(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	return token, nil
+}
 
-	// Sign token with secret key
-	tokenString, err := token.SignedString([]byte(s.jwtSecret))
+// issueTokens signs an access token for a user's session and stores a new
+// refresh token in the session's family
+func (s *authService) issueTokens(userID, sessionID string) (*TokenPair, error) {
+	now := time.Now()
+	// Sign token with the current signing key
+	accessToken, err := s.keys.Sign(jwt.MapClaims{
+		"sub": userID, // Use username as subject
+		"sid": sessionID,
+		"exp": now.Add(AccessTokenTTL).Unix(),
+		"iat": now.Unix(),
+	})
 	if err != nil {
 		log.Printf("Error signing JWT token: %v", err)
-		return "", err
+		return nil, err
 	}
 
-	log.Printf("Login successful for user: %s, token created", username)
-	return tokenString, nil
+	refreshToken, err := gonanoid.New(43)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	err = s.refreshTokenRepo.Create(&models.RefreshToken{
+		FamilyID:  sessionID,
+		UserID:    userID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// hashToken returns the hex SHA-256 of a token, which is what gets stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate cuts a client-supplied value to the size of its column
+func truncate(value string, size int) string {
+	if runes := []rune(value); len(runes) > size {
+		return string(runes[:size])
+	}
+	return value
 }
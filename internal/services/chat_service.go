@@ -1,8 +1,16 @@
 package services
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
 	"github.com/c0sm0thecoder/cli-chat-app/internal/realtime"
@@ -12,16 +20,64 @@ import (
 )
 
 type ChatService interface {
-	CreateRoom(roomName string) (*models.Room, error)
+	CreateRoom(roomName, creatorID string, private bool) (*models.Room, error)
+	JoinRoom(roomCode, userID, inviteToken string) (*models.Room, error)
+	AcceptInvite(inviteToken, userID string) (*models.Room, error)
+	CreateInvite(roomID, userID string, ttl time.Duration, maxUses int) (*models.RoomInvite, error)
+	ListInvites(roomID, userID string) ([]models.RoomInvite, error)
+	RevokeInvite(roomID, inviteID, userID string) error
+	RotateRoomCode(roomID, userID string) (*models.Room, error)
+	SetRoomPrivate(roomID, userID string, private bool) (*models.Room, error)
+	UpdateRoom(roomID, userID string, update RoomUpdate) (*models.Room, error)
+	SetRoomArchived(roomID, userID string, archived bool) (*models.Room, error)
+	ListRooms(userID string) ([]repositories.RoomSummary, error)
+	ListArchivedRooms(userID string) ([]repositories.RoomSummary, error)
+	ListDirectConversations(userID string) ([]repositories.RoomSummary, error)
+	GetDirectConversation(userID, peerID string) (*models.Room, error)
+	SendDirectMessage(senderID, peerID, messageContent string) (*models.Message, error)
+	IsMember(roomID, userID string) (bool, error)
+	GetMembers(roomID, userID string) ([]MemberPresence, error)
+	MemberRoomIDs(userID string) ([]string, error)
+	RecordLastSeen(userID string, at time.Time) error
+	SetMemberRole(roomID, actorID, userID, role string) (*models.RoomMember, error)
+	KickMember(roomID, actorID, userID string) error
+	BanMember(roomID, actorID, userID string) (*models.RoomBan, error)
+	UnbanMember(roomID, actorID, userID string) error
+	ListBans(roomID, userID string) ([]models.RoomBan, error)
+	MuteMember(roomID, actorID, userID string, duration time.Duration) (*models.RoomMember, error)
+	UnmuteMember(roomID, actorID, userID string) (*models.RoomMember, error)
 	SendMessage(roomID, senderID, messageContent string) (*models.Message, error)
-	GetMessages(roomID string) ([]models.Message, error)
-	GetRoomByCode(roomCode string) (*models.Room, error)
+	ReplyToMessage(roomID, parentID, senderID, messageContent string) (*models.Message, error)
+	GetMessages(roomID, userID string, page MessagePageRequest) (*MessagePage, error)
+	MessagesAfter(roomID, userID string, seq int64, limit int) (*models.Room, []models.Message, error)
+	GetRoomByCode(roomCode, userID, inviteToken string) (*models.Room, error)
+	EditMessage(roomID, messageID, editorID, messageContent string) (*models.Message, error)
+	GetMessageHistory(roomID, messageID, userID string) ([]models.MessageRevision, error)
+	DeleteMessage(roomID, messageID, userID string) error
+	GetThread(roomID, messageID, userID string) (*models.Message, []models.Message, error)
+	AddReaction(roomID, messageID, userID, emoji string) ([]models.ReactionCount, error)
+	RemoveReaction(roomID, messageID, userID, emoji string) ([]models.ReactionCount, error)
+	SearchMessages(userID string, search MessageSearchRequest) ([]repositories.MessageSearchHit, error)
+	GetMentions(userID string, limit int) ([]repositories.MentionInboxItem, error)
+	MarkRead(roomID, messageID, userID string) (*models.ReadReceipt, error)
+	GetReadReceipt(roomID, userID string) (*models.ReadReceipt, error)
+	GetUnreadCounts(userID string) ([]repositories.UnreadCount, error)
 }
 
 type chatService struct {
-	roomRepo    repositories.RoomRepository
-	messageRepo repositories.MessageRepository
-	userRepo    repositories.UserRepository
+	roomRepo     repositories.RoomRepository
+	messageRepo  repositories.MessageRepository
+	userRepo     repositories.UserRepository
+	reactionRepo repositories.ReactionRepository
+	mentionRepo  repositories.MentionRepository
+	receiptRepo  repositories.ReadReceiptRepository
+	memberRepo   repositories.RoomMemberRepository
+	inviteRepo   repositories.InviteRepository
+	hub          *realtime.Hub
+	moderators   map[string]bool
+
+	// Locks ordering the events of rooms, shared by rooms that hash alike
+	roomEventLocks [roomEventLockCount]sync.Mutex
 }
 
 var (
@@ -29,88 +85,1652 @@ var (
 	ErrEmptyMessage      = errors.New("message content cannot be empty")
 	ErrRoomNotFound      = errors.New("room not found")
 	ErrInvalidSenderID   = errors.New("invalid sender ID")
+	ErrMessageNotFound   = errors.New("message not found")
+	ErrNotMessageSender  = errors.New("only the sender can modify this message")
+	ErrForbidden         = errors.New("not allowed to perform this action")
+	ErrInvalidEmoji      = errors.New("invalid emoji shortcode")
+	ErrInvalidCursor     = errors.New("invalid cursor")
+	ErrEmptySearchQuery  = errors.New("search query cannot be empty")
+	ErrReceiptNotFound   = errors.New("read receipt not found")
+	ErrNotRoomMember     = errors.New("not a member of this room")
+	ErrMemberNotFound    = errors.New("room member not found")
+	ErrInvalidRole       = errors.New("invalid room role")
+	ErrInviteRequired    = errors.New("an invite is required to join this room")
+	ErrInvalidInvite     = errors.New("invite is invalid, expired or used up")
+	ErrInviteNotFound    = errors.New("invite not found")
+	ErrInvalidInviteSpec = errors.New("invalid invite expiry or max uses")
+	ErrNoConversation    = errors.New("no direct conversation with this user")
+	ErrMessageSelf       = errors.New("cannot start a direct conversation with yourself")
+	ErrRoomArchived      = errors.New("room is archived")
+	ErrRoomNameTooLong   = errors.New("room name is too long")
+	ErrTopicTooLong      = errors.New("room topic is too long")
+	ErrBanned            = errors.New("banned from this room")
+	ErrNotBanned         = errors.New("user is not banned from this room")
+	ErrMuted             = errors.New("muted in this room")
+	ErrInvalidMuteLength = errors.New("invalid mute duration")
+)
+
+const (
+	// roomPreviewLength is the number of characters of the latest message
+	// shown in room listings
+	roomPreviewLength = 80
+	// MaxRoomNameLength is the longest room name, in characters
+	MaxRoomNameLength = 100
+	// MaxTopicLength is the longest room topic, in characters
+	MaxTopicLength = 500
+	// roomEventLockCount is the number of locks the events of rooms are
+	// ordered with
+	roomEventLockCount = 64
+
+	// DefaultPageSize is the number of messages returned when no limit is given
+	DefaultPageSize = 50
+	// MaxPageSize caps the number of messages returned in one page
+	MaxPageSize = 200
+
+	// DefaultInviteTTL is how long an invite lasts when no expiry is given
+	DefaultInviteTTL = 24 * time.Hour
+	// MaxInviteTTL caps how long an invite can last
+	MaxInviteTTL = 30 * 24 * time.Hour
+	// inviteTokenPrefix tells invite tokens apart from room codes
+	inviteTokenPrefix = "inv_"
+
+	// MaxMuteDuration caps how long a member can be muted
+	MaxMuteDuration = 30 * 24 * time.Hour
 )
 
-func NewChatService(roomRepo repositories.RoomRepository, messageRepo repositories.MessageRepository, userRepo repositories.UserRepository) ChatService {
+// MessagePageRequest selects a page of a room's history using the opaque
+// cursors returned in MessagePage.NextCursor, or the page around a message
+type MessagePageRequest struct {
+	Before string
+	After  string
+	Around string // ID of a message to center the page on
+	Limit  int
+}
+
+// RoomUpdate holds the settings to change in UpdateRoom; nil fields are left
+// as they are
+type RoomUpdate struct {
+	Name  *string
+	Topic *string
+}
+
+// MemberPresence is a room member with their presence. LastSeen is when an
+// online or away member was last active, or when an offline member last
+// disconnected.
+type MemberPresence struct {
+	models.RoomMember
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// MessagePage is one page of a room's history, oldest message first.
+// NextCursor continues in the same direction: pass it as Before when paging
+// back through history, or as After when reading forwards. A page around a
+// message pages back with NextCursor and forwards with NewerCursor, which is
+// only set when newer messages follow. LastSeq is the room's newest message
+// sequence number when the page was read; clients pass it as resume_after
+// when connecting so nothing posted since is missed.
+type MessagePage struct {
+	Messages    []models.Message `json:"messages"`
+	NextCursor  string           `json:"next_cursor,omitempty"`
+	NewerCursor string           `json:"newer_cursor,omitempty"`
+	HasMore     bool             `json:"has_more"`
+	LastSeq     int64            `json:"last_seq"`
+}
+
+// MessageSearchRequest filters a full-text search over the messages of the
+// rooms the caller is a member of
+type MessageSearchRequest struct {
+	Query    string
+	RoomID   string
+	SenderID string
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+}
+
+// maxMentionsPerMessage caps how many users a single message can notify
+const maxMentionsPerMessage = 20
+
+// mentionPattern matches @username tokens that are not part of a longer word,
+// such as an email address
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.\-]+)`)
+
+// emojiShortcode matches shortcodes such as thumbsup or +1, without the colons
+var emojiShortcode = regexp.MustCompile(`^[a-z0-9_+\-]{1,32}$`)
+
+// NewChatService creates the chat service. Users listed in moderators may
+// delete any message in any room.
+func NewChatService(roomRepo repositories.RoomRepository, messageRepo repositories.MessageRepository, userRepo repositories.UserRepository, reactionRepo repositories.ReactionRepository, mentionRepo repositories.MentionRepository, receiptRepo repositories.ReadReceiptRepository, memberRepo repositories.RoomMemberRepository, inviteRepo repositories.InviteRepository, hub *realtime.Hub, moderators []string) ChatService {
+	moderatorSet := make(map[string]bool, len(moderators))
+	for _, moderator := range moderators {
+		moderatorSet[moderator] = true
+	}
+
 	return &chatService{
-		roomRepo:    roomRepo,
-		messageRepo: messageRepo,
-		userRepo:    userRepo,
+		roomRepo:     roomRepo,
+		messageRepo:  messageRepo,
+		userRepo:     userRepo,
+		reactionRepo: reactionRepo,
+		mentionRepo:  mentionRepo,
+		receiptRepo:  receiptRepo,
+		memberRepo:   memberRepo,
+		inviteRepo:   inviteRepo,
+		hub:          hub,
+		moderators:   moderatorSet,
 	}
 }
 
-func (s *chatService) CreateRoom(roomName string) (*models.Room, error) {
+// CreateRoom creates a room owned by its creator. Private rooms can only be
+// joined with an invite.
+func (s *chatService) CreateRoom(roomName, creatorID string, private bool) (*models.Room, error) {
+	roomName = strings.TrimSpace(roomName)
 	if roomName == "" {
 		return nil, ErrEmptyRoomName
 	}
+	if utf8.RuneCountInString(roomName) > MaxRoomNameLength {
+		return nil, ErrRoomNameTooLong
+	}
 	
 	// Generate a unique room code
-	roomCode, err := gonanoid.New(12)
+	roomCode, err := newRoomCode()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate room code: %w", err)
+		return nil, err
 	}
 	
 	room := &models.Room{
-		Name: roomName,
-		Code: roomCode,
+		Name:    roomName,
+		Code:    roomCode,
+		Private: private,
+		Kind:    models.RoomKindGroup,
+	}
+	owner := models.RoomMember{
+		UserID: creatorID,
+		Role:   models.RoleOwner,
 	}
 	
-	if err := s.roomRepo.Create(room); err != nil {
+	if err := s.roomRepo.CreateWithMembers(room, []models.RoomMember{owner}); err != nil {
 		return nil, err
 	}
 	
 	return room, nil
 }
 
-func (s *chatService) SendMessage(roomID, senderID, messageContent string) (*models.Message, error) {
-	if messageContent == "" {
-		return nil, ErrEmptyMessage
+// JoinRoom makes the user a member of the room with the given code. Private
+// rooms also need an invite unless the user is already a member.
+func (s *chatService) JoinRoom(roomCode, userID, inviteToken string) (*models.Room, error) {
+	room, err := s.findRoomByCode(roomCode)
+	if err != nil {
+		return nil, err
 	}
-	
-	if senderID == "" {
-		return nil, ErrInvalidSenderID
+	if err := s.requireNotBanned(room.ID, userID); err != nil {
+		return nil, err
 	}
-	
-	message := &models.Message{
-		RoomID:   roomID,
-		SenderID: senderID,
-		Content:  messageContent,
+
+	if room.Private {
+		isMember, err := s.IsMember(room.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if isMember {
+			return room, nil
+		}
+		if inviteToken == "" {
+			return nil, ErrInviteRequired
+		}
+		// An invite to another room is refused without using it up
+		if err := s.consumeInvite(room.ID, inviteToken); err != nil {
+			return nil, err
+		}
 	}
-	
-	if err := s.messageRepo.Create(message); err != nil {
+
+	return room, s.addMember(room.ID, userID)
+}
+
+// AcceptInvite makes the user a member of the room an invite belongs to
+func (s *chatService) AcceptInvite(inviteToken, userID string) (*models.Room, error) {
+	invite, err := s.inviteRepo.FindByToken(inviteToken)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidInvite
+		}
+		return nil, fmt.Errorf("failed to find invite: %w", err)
+	}
+
+	room, err := s.roomRepo.FindByID(invite.RoomID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoomNotFound
+		}
 		return nil, err
 	}
-	
-	// Get user info for the sender (for display name)
-	user, err := s.userRepo.FindByUsername(senderID)
-	
-	// Get username to display
-	username := senderID // Default to ID if user can't be found
-	if err == nil && user != nil {
-		username = user.UserName
+
+	if err := s.requireNotBanned(room.ID, userID); err != nil {
+		return nil, err
 	}
-	
-	// Broadcast the message to all WebSocket clients in this room
-	go realtime.BroadcastMessage(roomID, message, username)
-	
-	return message, nil
+
+	// Members following an old invite do not use it up
+	isMember, err := s.IsMember(room.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isMember {
+		return room, nil
+	}
+	if err := s.consumeInvite(room.ID, inviteToken); err != nil {
+		return nil, err
+	}
+	return room, s.addMember(room.ID, userID)
 }
 
-func (s *chatService) GetMessages(roomID string) ([]models.Message, error) {
-	messages, err := s.messageRepo.FindByRoom(roomID)
+// CreateInvite creates an invite to a room that expires after ttl and can be
+// used maxUses times, or any number of times when maxUses is 0
+func (s *chatService) CreateInvite(roomID, userID string, ttl time.Duration, maxUses int) (*models.RoomInvite, error) {
+	if ttl == 0 {
+		ttl = DefaultInviteTTL
+	}
+	if ttl < 0 || ttl > MaxInviteTTL || maxUses < 0 {
+		return nil, ErrInvalidInviteSpec
+	}
+
+	if _, err := s.requireRoomAdmin(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	id, err := gonanoid.New(24)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
+		return nil, fmt.Errorf("failed to generate invite token: %w", err)
+	}
+
+	invite := &models.RoomInvite{
+		RoomID:    roomID,
+		Token:     inviteTokenPrefix + id,
+		CreatedBy: userID,
+		ExpiresAt: time.Now().Add(ttl),
+		MaxUses:   maxUses,
+	}
+	if err := s.inviteRepo.Create(invite); err != nil {
+		return nil, err
 	}
-	return messages, nil
+	return invite, nil
 }
 
-func (s *chatService) GetRoomByCode(roomCode string) (*models.Room, error) {
-	room, err := s.roomRepo.FindByCode(roomCode)
+// ListInvites returns the invites of a room that can still be used
+func (s *chatService) ListInvites(roomID, userID string) ([]models.RoomInvite, error) {
+	if _, err := s.requireRoomAdmin(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	invites, err := s.inviteRepo.FindActiveByRoom(roomID)
 	if err != nil {
+		return nil, err
+	}
+	if invites == nil {
+		invites = []models.RoomInvite{}
+	}
+	return invites, nil
+}
+
+func (s *chatService) RevokeInvite(roomID, inviteID, userID string) error {
+	if _, err := s.requireRoomAdmin(roomID, userID); err != nil {
+		return err
+	}
+
+	if err := s.inviteRepo.Revoke(roomID, inviteID); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrRoomNotFound
+			return ErrInviteNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// RotateRoomCode gives a room a new code so the old one can no longer be used to join
+func (s *chatService) RotateRoomCode(roomID, userID string) (*models.Room, error) {
+	if _, err := s.requireRoomAdmin(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	room, err := s.findRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	if room.Code, err = newRoomCode(); err != nil {
+		return nil, err
+	}
+	if err := s.roomRepo.Update(room); err != nil {
+		return nil, err
+	}
+	s.inRoomOrder(roomID, func() {
+		room.ChangeSeq = s.recordChange(roomID)
+		s.hub.BroadcastRoomUpdated(room, userID)
+	})
+	return room, nil
+}
+
+// SetRoomPrivate makes joining a room require an invite, or lifts that requirement
+func (s *chatService) SetRoomPrivate(roomID, userID string, private bool) (*models.Room, error) {
+	if _, err := s.requireRoomAdmin(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	room, err := s.findRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	room.Private = private
+	if err := s.roomRepo.Update(room); err != nil {
+		return nil, err
+	}
+	s.inRoomOrder(roomID, func() {
+		room.ChangeSeq = s.recordChange(roomID)
+		s.hub.BroadcastRoomUpdated(room, userID)
+	})
+	return room, nil
+}
+
+// UpdateRoom renames a room or changes its topic
+func (s *chatService) UpdateRoom(roomID, userID string, update RoomUpdate) (*models.Room, error) {
+	if _, err := s.requireRoomAdmin(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	room, err := s.findRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, ErrEmptyRoomName
+		}
+		if utf8.RuneCountInString(name) > MaxRoomNameLength {
+			return nil, ErrRoomNameTooLong
+		}
+		room.Name = name
+	}
+	if update.Topic != nil {
+		topic := strings.TrimSpace(*update.Topic)
+		if utf8.RuneCountInString(topic) > MaxTopicLength {
+			return nil, ErrTopicTooLong
+		}
+		room.Topic = topic
+	}
+
+	if err := s.roomRepo.Update(room); err != nil {
+		return nil, err
+	}
+	s.inRoomOrder(roomID, func() {
+		room.ChangeSeq = s.recordChange(roomID)
+		s.hub.BroadcastRoomUpdated(room, userID)
+	})
+	return room, nil
+}
+
+// SetRoomArchived archives a room, making it read-only and hiding it from room
+// listings, or brings it back. Its members can still read its history.
+func (s *chatService) SetRoomArchived(roomID, userID string, archived bool) (*models.Room, error) {
+	if _, err := s.requireRoomAdmin(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	room, err := s.findRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the original archive time when archiving twice
+	if archived == room.Archived() {
+		return room, nil
+	}
+	if archived {
+		now := time.Now()
+		room.ArchivedAt = &now
+	} else {
+		room.ArchivedAt = nil
+	}
+	if err := s.roomRepo.Update(room); err != nil {
+		return nil, err
+	}
+	s.inRoomOrder(roomID, func() {
+		room.ChangeSeq = s.recordChange(roomID)
+		s.hub.BroadcastRoomUpdated(room, userID)
+	})
+	return room, nil
+}
+
+// consumeInvite uses up one use of an invite to a room
+func (s *chatService) consumeInvite(roomID, inviteToken string) error {
+	if _, err := s.inviteRepo.Consume(roomID, inviteToken); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidInvite
+		}
+		return err
+	}
+	return nil
+}
+
+// addMember makes a user a plain member of a room
+func (s *chatService) addMember(roomID, userID string) error {
+	return s.memberRepo.Add(&models.RoomMember{
+		RoomID: roomID,
+		UserID: userID,
+		Role:   models.RoleMember,
+	})
+}
+
+// newRoomCode generates a random room code
+func newRoomCode() (string, error) {
+	code, err := gonanoid.New(12)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate room code: %w", err)
+	}
+	return code, nil
+}
+
+// ListRooms returns the active rooms the user has created or joined, with a
+// preview of each room's latest message
+func (s *chatService) ListRooms(userID string) ([]repositories.RoomSummary, error) {
+	return s.listRooms(userID, models.RoomKindGroup, false)
+}
+
+// ListArchivedRooms returns the archived rooms the user is a member of
+func (s *chatService) ListArchivedRooms(userID string) ([]repositories.RoomSummary, error) {
+	return s.listRooms(userID, models.RoomKindGroup, true)
+}
+
+// ListDirectConversations returns the user's direct conversations, each with
+// the other user as Peer
+func (s *chatService) ListDirectConversations(userID string) ([]repositories.RoomSummary, error) {
+	return s.listRooms(userID, models.RoomKindDirect, false)
+}
+
+// listRooms returns the user's rooms of a kind with shortened message previews
+func (s *chatService) listRooms(userID, kind string, archived bool) ([]repositories.RoomSummary, error) {
+	rooms, err := s.roomRepo.FindByMember(userID, kind, archived)
+	if err != nil {
+		return nil, err
+	}
+	if rooms == nil {
+		rooms = []repositories.RoomSummary{}
+	}
+
+	for i := range rooms {
+		if preview := rooms[i].LastMessage; preview != nil {
+			if runes := []rune(*preview); len(runes) > roomPreviewLength {
+				truncated := string(runes[:roomPreviewLength]) + "…"
+				rooms[i].LastMessage = &truncated
+			}
+		}
+	}
+	return rooms, nil
+}
+
+// GetDirectConversation returns the direct conversation between two users,
+// or ErrNoConversation if they have not written to each other yet
+func (s *chatService) GetDirectConversation(userID, peerID string) (*models.Room, error) {
+	directKey, err := s.directKey(userID, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	room, err := s.roomRepo.FindByDirectKey(directKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoConversation
+		}
+		return nil, err
+	}
+	return room, nil
+}
+
+// SendDirectMessage posts a message to the direct conversation with another
+// user, starting the conversation on the first message
+func (s *chatService) SendDirectMessage(senderID, peerID, messageContent string) (*models.Message, error) {
+	if messageContent == "" {
+		return nil, ErrEmptyMessage
+	}
+
+	room, err := s.GetDirectConversation(senderID, peerID)
+	if err == ErrNoConversation {
+		room, err = s.createDirectConversation(senderID, peerID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.postMessage(room.ID, nil, senderID, messageContent)
+}
+
+// createDirectConversation creates the private room behind a direct conversation
+func (s *chatService) createDirectConversation(userID, peerID string) (*models.Room, error) {
+	directKey, err := s.directKey(userID, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	roomCode, err := newRoomCode()
+	if err != nil {
+		return nil, err
+	}
+
+	room := &models.Room{
+		Name:      "Direct message",
+		Code:      roomCode,
+		Private:   true,
+		Kind:      models.RoomKindDirect,
+		DirectKey: &directKey,
+	}
+	members := []models.RoomMember{
+		{UserID: userID, Role: models.RoleMember},
+		{UserID: peerID, Role: models.RoleMember},
+	}
+	if err := s.roomRepo.CreateWithMembers(room, members); err != nil {
+		// Both users may have started the conversation at the same time
+		if existing, findErr := s.roomRepo.FindByDirectKey(directKey); findErr == nil {
+			return existing, nil
 		}
 		return nil, err
 	}
 	return room, nil
 }
+
+// directKey identifies the direct conversation between two existing users,
+// whichever of them asks
+func (s *chatService) directKey(userID, peerID string) (string, error) {
+	if userID == peerID {
+		return "", ErrMessageSelf
+	}
+	if _, err := s.userRepo.FindByUsername(peerID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrUserNotFound
+		}
+		return "", err
+	}
+
+	first, second := userID, peerID
+	if second < first {
+		first, second = second, first
+	}
+	// The length prefix keeps the key unambiguous whatever the usernames contain
+	return fmt.Sprintf("%d:%s:%s", len(first), first, second), nil
+}
+
+func (s *chatService) IsMember(roomID, userID string) (bool, error) {
+	if _, err := s.requireMember(roomID, userID); err != nil {
+		if err == ErrNotRoomMember {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GetMembers lists the members of a room the user belongs to with their presence
+func (s *chatService) GetMembers(roomID, userID string) ([]MemberPresence, error) {
+	if _, err := s.requireMember(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	members, err := s.memberRepo.FindByRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MemberPresence, len(members))
+	var offline []string
+	for i, member := range members {
+		presence := s.hub.GetPresence(member.UserID)
+		result[i] = MemberPresence{
+			RoomMember: member,
+			Status:     presence.Status,
+			LastSeen:   presence.LastSeen,
+		}
+		if presence.Status == realtime.StatusOffline {
+			offline = append(offline, member.UserID)
+		}
+	}
+	if len(offline) == 0 {
+		return result, nil
+	}
+
+	lastSeen, err := s.userRepo.FindLastSeen(offline)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result {
+		if seen, ok := lastSeen[result[i].UserID]; ok && result[i].Status == realtime.StatusOffline {
+			result[i].LastSeen = &seen
+		}
+	}
+	return result, nil
+}
+
+// MemberRoomIDs returns the IDs of the rooms a user is a member of
+func (s *chatService) MemberRoomIDs(userID string) ([]string, error) {
+	return s.memberRepo.FindRoomIDsByUser(userID)
+}
+
+// RecordLastSeen remembers when a user was last connected
+func (s *chatService) RecordLastSeen(userID string, at time.Time) error {
+	return s.userRepo.UpdateLastSeen(userID, at)
+}
+
+// SetMemberRole makes a member an admin or a plain member. Only the room
+// owner may change roles, and ownership cannot be given away.
+func (s *chatService) SetMemberRole(roomID, actorID, userID, role string) (*models.RoomMember, error) {
+	if role != models.RoleAdmin && role != models.RoleMember {
+		return nil, ErrInvalidRole
+	}
+
+	actor, err := s.requireMember(roomID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role != models.RoleOwner {
+		return nil, ErrForbidden
+	}
+
+	member, err := s.memberRepo.Find(roomID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMemberNotFound
+		}
+		return nil, err
+	}
+	if member.Role == models.RoleOwner {
+		return nil, ErrForbidden
+	}
+
+	if err := s.memberRepo.UpdateRole(roomID, userID, role); err != nil {
+		return nil, err
+	}
+	member.Role = role
+	return member, nil
+}
+
+// KickMember removes a member from a room and closes their connections to it.
+// They can rejoin the way anyone else can.
+func (s *chatService) KickMember(roomID, actorID, userID string) error {
+	if _, err := s.moderationTarget(roomID, actorID, userID); err != nil {
+		return err
+	}
+
+	if err := s.memberRepo.Remove(roomID, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMemberNotFound
+		}
+		return err
+	}
+
+	s.inRoomOrder(roomID, func() {
+		s.hub.DisconnectFromRoom(roomID, userID, "kicked")
+		s.hub.BroadcastSystemMessage(roomID, fmt.Sprintf("%s was kicked by %s", userID, actorID), s.recordChange(roomID))
+	})
+	return nil
+}
+
+// BanMember removes a user from a room, if they are a member, and keeps them
+// from joining it again until they are unbanned
+func (s *chatService) BanMember(roomID, actorID, userID string) (*models.RoomBan, error) {
+	_, err := s.moderationTarget(roomID, actorID, userID)
+	if err == ErrMemberNotFound {
+		// Users can be banned before they ever join
+		if _, err = s.userRepo.FindByUsername(userID); errors.Is(err, gorm.ErrRecordNotFound) {
+			err = ErrUserNotFound
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ban := &models.RoomBan{
+		RoomID:   roomID,
+		UserID:   userID,
+		BannedBy: actorID,
+	}
+	if err := s.memberRepo.Ban(ban); err != nil {
+		return nil, err
+	}
+
+	s.inRoomOrder(roomID, func() {
+		s.hub.DisconnectFromRoom(roomID, userID, "banned")
+		s.hub.BroadcastSystemMessage(roomID, fmt.Sprintf("%s was banned by %s", userID, actorID), s.recordChange(roomID))
+	})
+	return ban, nil
+}
+
+// UnbanMember lets a banned user join a room again
+func (s *chatService) UnbanMember(roomID, actorID, userID string) error {
+	if _, err := s.requireRoomAdmin(roomID, actorID); err != nil {
+		return err
+	}
+
+	if err := s.memberRepo.Unban(roomID, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotBanned
+		}
+		return err
+	}
+	return nil
+}
+
+// ListBans returns the users banned from a room, most recent first
+func (s *chatService) ListBans(roomID, userID string) ([]models.RoomBan, error) {
+	if _, err := s.requireRoomAdmin(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	bans, err := s.memberRepo.FindBansByRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if bans == nil {
+		bans = []models.RoomBan{}
+	}
+	return bans, nil
+}
+
+// MuteMember keeps a member from posting in a room for the given duration
+func (s *chatService) MuteMember(roomID, actorID, userID string, duration time.Duration) (*models.RoomMember, error) {
+	if duration <= 0 || duration > MaxMuteDuration {
+		return nil, ErrInvalidMuteLength
+	}
+
+	member, err := s.moderationTarget(roomID, actorID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	mutedUntil := time.Now().Add(duration)
+	if err := s.memberRepo.SetMutedUntil(roomID, userID, &mutedUntil); err != nil {
+		return nil, err
+	}
+	member.MutedUntil = &mutedUntil
+
+	go s.hub.BroadcastSystemMessage(roomID, fmt.Sprintf("%s was muted for %s by %s", userID, formatDuration(duration), actorID), 0)
+	return member, nil
+}
+
+// UnmuteMember lets a muted member post again before their mute expires
+func (s *chatService) UnmuteMember(roomID, actorID, userID string) (*models.RoomMember, error) {
+	member, err := s.moderationTarget(roomID, actorID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !member.Muted(time.Now()) {
+		return member, nil
+	}
+
+	if err := s.memberRepo.SetMutedUntil(roomID, userID, nil); err != nil {
+		return nil, err
+	}
+	member.MutedUntil = nil
+
+	go s.hub.BroadcastSystemMessage(roomID, fmt.Sprintf("%s was unmuted by %s", userID, actorID), 0)
+	return member, nil
+}
+
+// moderationTarget returns the membership of the user a room owner or admin
+// wants to act on. Nobody can act on themselves or on the owner, and only
+// the owner can act on admins.
+func (s *chatService) moderationTarget(roomID, actorID, userID string) (*models.RoomMember, error) {
+	actor, err := s.requireRoomAdmin(roomID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if actorID == userID {
+		return nil, ErrForbidden
+	}
+
+	member, err := s.memberRepo.Find(roomID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMemberNotFound
+		}
+		return nil, err
+	}
+	if member.Role == models.RoleOwner || (member.Role == models.RoleAdmin && actor.Role != models.RoleOwner) {
+		return nil, ErrForbidden
+	}
+	return member, nil
+}
+
+// requireNotBanned returns ErrBanned if the user is banned from the room
+func (s *chatService) requireNotBanned(roomID, userID string) error {
+	if _, err := s.memberRepo.FindBan(roomID, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to check room ban: %w", err)
+	}
+	return ErrBanned
+}
+
+// formatDuration prints a duration without trailing zero units, such as 10m or 1h30m
+func formatDuration(d time.Duration) string {
+	text := d.Round(time.Second).String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// requireRoomAdmin returns the user's membership of a room if they are its
+// owner or an admin
+func (s *chatService) requireRoomAdmin(roomID, userID string) (*models.RoomMember, error) {
+	member, err := s.requireMember(roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !member.CanModerate() {
+		return nil, ErrForbidden
+	}
+	return member, nil
+}
+
+// requireActiveRoom returns ErrRoomArchived if the room is archived and so
+// read-only
+func (s *chatService) requireActiveRoom(roomID string) error {
+	room, err := s.findRoom(roomID)
+	if err != nil {
+		return err
+	}
+	if room.Archived() {
+		return ErrRoomArchived
+	}
+	return nil
+}
+
+// requireMember returns the user's membership of a room, or ErrNotRoomMember
+func (s *chatService) requireMember(roomID, userID string) (*models.RoomMember, error) {
+	member, err := s.memberRepo.Find(roomID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotRoomMember
+		}
+		return nil, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	return member, nil
+}
+
+func (s *chatService) SendMessage(roomID, senderID, messageContent string) (*models.Message, error) {
+	return s.postMessage(roomID, nil, senderID, messageContent)
+}
+
+// ReplyToMessage posts a reply in the thread of a message. postMessage checks
+// that the sender may post.
+func (s *chatService) ReplyToMessage(roomID, parentID, senderID, messageContent string) (*models.Message, error) {
+	parent, err := s.findRoomMessage(roomID, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Threads are one level deep: replying to a reply joins the same thread
+	threadID := parent.ID
+	if parent.ParentID != nil {
+		threadID = *parent.ParentID
+	}
+
+	return s.postMessage(roomID, &threadID, senderID, messageContent)
+}
+
+// postMessage stores a message, optionally as a reply, and broadcasts it to the room
+func (s *chatService) postMessage(roomID string, parentID *string, senderID, messageContent string) (*models.Message, error) {
+	if messageContent == "" {
+		return nil, ErrEmptyMessage
+	}
+	
+	if senderID == "" {
+		return nil, ErrInvalidSenderID
+	}
+
+	member, err := s.requireMember(roomID, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if member.Muted(time.Now()) {
+		return nil, ErrMuted
+	}
+	if err := s.requireActiveRoom(roomID); err != nil {
+		return nil, err
+	}
+	
+	message := &models.Message{
+		RoomID:   roomID,
+		SenderID: senderID,
+		ParentID: parentID,
+		Content:  messageContent,
+	}
+	
+	// Get user info for the sender (for display name)
+	user, err := s.userRepo.FindByUsername(senderID)
+	
+	// Get username to display
+	username := senderID // Default to ID if user can't be found
+	if err == nil && user != nil {
+		username = user.UserName
+	}
+	
+	// Store the message and broadcast it to all WebSocket clients in this
+	// room, in the order of its sequence number
+	s.inRoomOrder(roomID, func() {
+		if err = s.messageRepo.Create(message); err == nil {
+			s.hub.BroadcastMessage(roomID, message, username)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The message is already stored, so failing to notify mentioned users
+	// or the other side of a direct conversation should not fail the send
+	if err := s.notifyRecipients(message); err != nil {
+		log.Printf("Failed to notify recipients of message %s: %v", message.ID, err)
+	}
+	
+	return message, nil
+}
+
+// notifyRecipients tells the other user of a direct conversation about a new
+// message, or the members mentioned in a room message
+func (s *chatService) notifyRecipients(message *models.Message) error {
+	room, err := s.roomRepo.FindByID(message.RoomID)
+	if err != nil {
+		return err
+	}
+	if room.Kind != models.RoomKindDirect {
+		return s.notifyMentions(message, room.Name)
+	}
+
+	members, err := s.memberRepo.FindByRoom(room.ID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.UserID != message.SenderID {
+			go s.hub.BroadcastDirectMessage(member.UserID, message)
+		}
+	}
+	return nil
+}
+
+// notifyMentions stores a mention for every room member named in a message
+// and delivers it to them
+func (s *chatService) notifyMentions(message *models.Message, roomName string) error {
+	var mentions []models.Mention
+	for _, username := range parseMentions(message.Content) {
+		if username == message.SenderID {
+			continue
+		}
+		if _, err := s.memberRepo.Find(message.RoomID, username); err != nil {
+			continue
+		}
+		mentions = append(mentions, models.Mention{
+			MessageID:   message.ID,
+			RoomID:      message.RoomID,
+			UserID:      username,
+			MentionedBy: message.SenderID,
+		})
+	}
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	if err := s.mentionRepo.CreateBatch(mentions); err != nil {
+		return err
+	}
+
+	for i := range mentions {
+		go s.hub.BroadcastMention(&mentions[i], message, roomName)
+	}
+	return nil
+}
+
+// parseMentions returns the distinct usernames mentioned in a message, in order
+func parseMentions(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// Punctuation ending a sentence is not part of the name
+		username := strings.TrimRight(match[1], ".-")
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+		if len(usernames) == maxMentionsPerMessage {
+			break
+		}
+	}
+	return usernames
+}
+
+func (s *chatService) GetMessages(roomID, userID string, page MessagePageRequest) (*MessagePage, error) {
+	if _, err := s.requireMember(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	if page.Before != "" && page.After != "" {
+		return nil, ErrInvalidCursor
+	}
+	if page.Around != "" && (page.Before != "" || page.After != "") {
+		return nil, ErrInvalidCursor
+	}
+
+	query := repositories.MessagePageQuery{Limit: page.Limit}
+	if query.Limit <= 0 {
+		query.Limit = DefaultPageSize
+	} else if query.Limit > MaxPageSize {
+		query.Limit = MaxPageSize
+	}
+	if page.Around != "" {
+		return s.messagesAround(roomID, page.Around, query.Limit)
+	}
+
+	var err error
+	if page.Before != "" {
+		if query.Before, err = decodeCursor(page.Before); err != nil {
+			return nil, err
+		}
+	}
+	if page.After != "" {
+		if query.After, err = decodeCursor(page.After); err != nil {
+			return nil, err
+		}
+	}
+
+	// Read before the page so a message posted in between is replayed
+	// rather than missed
+	room, err := s.findRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, hasMore, err := s.messageRepo.FindPage(roomID, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
+	}
+
+	if messages == nil {
+		messages = []models.Message{}
+	}
+	result := &MessagePage{
+		Messages: messages,
+		HasMore:  hasMore,
+		LastSeq:  room.LastSeq,
+	}
+	if len(messages) > 0 {
+		// The next page starts after the newest message when reading forwards,
+		// otherwise before the oldest one
+		edge := messages[0]
+		if query.After != nil {
+			edge = messages[len(messages)-1]
+		}
+		result.NextCursor = encodeCursor(edge)
+	}
+
+	if err := s.prepareTimeline(messages); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// messagesAround returns the page of the room's timeline centered on a
+// message, so clients can show it in context without paging back to it. A
+// reply is shown around the message it replies to.
+func (s *chatService) messagesAround(roomID, messageID string, limit int) (*MessagePage, error) {
+	room, err := s.findRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	center, err := s.findRoomMessage(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if center.ParentID != nil {
+		if center, err = s.findRoomMessage(roomID, *center.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Split the rest of the page between older and newer messages
+	position := &repositories.MessageCursor{CreatedAt: center.CreatedAt, ID: center.ID}
+	olderLimit := (limit - 1) / 2
+	older, hasOlder, err := s.messageRepo.FindPage(roomID, repositories.MessagePageQuery{Before: position, Limit: olderLimit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
+	}
+	newer, hasNewer, err := s.messageRepo.FindPage(roomID, repositories.MessagePageQuery{After: position, Limit: limit - 1 - olderLimit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
+	}
+
+	messages := append(append(older, *center), newer...)
+	result := &MessagePage{
+		Messages:   messages,
+		NextCursor: encodeCursor(messages[0]),
+		HasMore:    hasOlder,
+		LastSeq:    room.LastSeq,
+	}
+	if hasNewer {
+		result.NewerCursor = encodeCursor(messages[len(messages)-1])
+	}
+
+	if err := s.prepareTimeline(messages); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// prepareTimeline fills in the reply counts and reactions of top-level
+// messages and hides the content of deleted ones
+func (s *chatService) prepareTimeline(messages []models.Message) error {
+	parentIDs := make([]string, len(messages))
+	for i := range messages {
+		parentIDs[i] = messages[i].ID
+	}
+	replyCounts, err := s.messageRepo.CountReplies(parentIDs)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve reply counts: %w", err)
+	}
+
+	for i := range messages {
+		messages[i].ReplyCount = replyCounts[messages[i].ID]
+	}
+	if err := s.attachReactions(messages); err != nil {
+		return err
+	}
+	hideDeletedContent(messages)
+	return nil
+}
+
+// MessagesAfter returns the room and up to limit of its messages, replies
+// included, numbered after seq. Reconnecting clients use it to catch up; the
+// room's ChangeSeq tells whether anything besides new messages happened.
+func (s *chatService) MessagesAfter(roomID, userID string, seq int64, limit int) (*models.Room, []models.Message, error) {
+	if _, err := s.requireMember(roomID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	// Read the room first; a change made in between reaches the client live
+	room, err := s.findRoom(roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	messages, err := s.messageRepo.FindAfterSeq(roomID, seq, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return room, messages, nil
+}
+
+// inRoomOrder runs fn holding the lock of a room's events. Numbering an event
+// and publishing it under the lock makes the events of this node reach the
+// broker in the order of their sequence numbers, which resuming clients rely
+// on: a client that saw an event has seen every event numbered before it.
+func (s *chatService) inRoomOrder(roomID string, fn func()) {
+	hash := fnv.New32a()
+	hash.Write([]byte(roomID))
+	lock := &s.roomEventLocks[hash.Sum32()%roomEventLockCount]
+
+	lock.Lock()
+	defer lock.Unlock()
+	fn()
+}
+
+// recordChange numbers a change of a room other than a new message, so that
+// clients resuming from before it reload the room rather than replay only its
+// new messages. It returns the change's sequence number, or 0 if it could not
+// be recorded.
+func (s *chatService) recordChange(roomID string) int64 {
+	seq, err := s.roomRepo.RecordChange(roomID)
+	if err != nil {
+		log.Printf("Failed to record a change of room %s: %v", roomID, err)
+	}
+	return seq
+}
+
+func (s *chatService) SearchMessages(userID string, search MessageSearchRequest) ([]repositories.MessageSearchHit, error) {
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Query == "" {
+		return nil, ErrEmptySearchQuery
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	} else if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	hits, err := s.messageRepo.Search(repositories.MessageSearchQuery{
+		UserID:   userID,
+		Text:     search.Query,
+		RoomID:   search.RoomID,
+		SenderID: search.SenderID,
+		From:     search.From,
+		To:       search.To,
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if hits == nil {
+		hits = []repositories.MessageSearchHit{}
+	}
+	return hits, nil
+}
+
+// GetMentions returns the latest mentions of a user, newest first
+func (s *chatService) GetMentions(userID string, limit int) ([]repositories.MentionInboxItem, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	} else if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	mentions, err := s.mentionRepo.FindByUser(userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if mentions == nil {
+		mentions = []repositories.MentionInboxItem{}
+	}
+	return mentions, nil
+}
+
+// MarkRead moves the user's read pointer in a room up to a message. Reading
+// an older message than the one already read leaves the pointer in place.
+func (s *chatService) MarkRead(roomID, messageID, userID string) (*models.ReadReceipt, error) {
+	if _, err := s.requireMember(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	message, err := s.findRoomMessage(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := &models.ReadReceipt{
+		RoomID:            roomID,
+		UserID:            userID,
+		LastReadMessageID: message.ID,
+		LastReadAt:        message.CreatedAt,
+	}
+	advanced, err := s.receiptRepo.Advance(receipt)
+	if err != nil {
+		return nil, err
+	}
+	if !advanced {
+		return s.GetReadReceipt(roomID, userID)
+	}
+
+	go s.hub.BroadcastReadReceipt(receipt)
+
+	return receipt, nil
+}
+
+func (s *chatService) GetReadReceipt(roomID, userID string) (*models.ReadReceipt, error) {
+	receipt, err := s.receiptRepo.Find(roomID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReceiptNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve read receipt: %w", err)
+	}
+	return receipt, nil
+}
+
+// GetUnreadCounts returns the unread message count of every room the user
+// is a member of
+func (s *chatService) GetUnreadCounts(userID string) ([]repositories.UnreadCount, error) {
+	counts, err := s.receiptRepo.CountUnread(userID)
+	if err != nil {
+		return nil, err
+	}
+	if counts == nil {
+		counts = []repositories.UnreadCount{}
+	}
+	return counts, nil
+}
+
+// encodeCursor turns the position of a message into an opaque cursor
+func encodeCursor(message models.Message) string {
+	raw := message.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + message.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor
+func decodeCursor(cursor string) (*repositories.MessageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &repositories.MessageCursor{CreatedAt: timestamp, ID: id}, nil
+}
+
+// GetRoomByCode looks up a room by its code. Private rooms are only shown to
+// their members and to holders of a valid invite.
+func (s *chatService) GetRoomByCode(roomCode, userID, inviteToken string) (*models.Room, error) {
+	room, err := s.findRoomByCode(roomCode)
+	if err != nil {
+		return nil, err
+	}
+	if !room.Private {
+		return room, nil
+	}
+
+	isMember, err := s.IsMember(room.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isMember {
+		return room, nil
+	}
+	if inviteToken == "" {
+		return nil, ErrInviteRequired
+	}
+	invite, err := s.inviteRepo.FindByToken(inviteToken)
+	if err != nil || invite.RoomID != room.ID || !invite.Usable(time.Now()) {
+		return nil, ErrInvalidInvite
+	}
+	return room, nil
+}
+
+func (s *chatService) findRoomByCode(roomCode string) (*models.Room, error) {
+	room, err := s.roomRepo.FindByCode(roomCode)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+	return room, nil
+}
+
+func (s *chatService) findRoom(roomID string) (*models.Room, error) {
+	room, err := s.roomRepo.FindByID(roomID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+	return room, nil
+}
+
+func (s *chatService) EditMessage(roomID, messageID, editorID, messageContent string) (*models.Message, error) {
+	if messageContent == "" {
+		return nil, ErrEmptyMessage
+	}
+
+	if _, err := s.requireMember(roomID, editorID); err != nil {
+		return nil, err
+	}
+	if err := s.requireActiveRoom(roomID); err != nil {
+		return nil, err
+	}
+
+	message, err := s.findRoomMessage(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.SenderID != editorID {
+		return nil, ErrNotMessageSender
+	}
+
+	// Nothing to record if the content did not change
+	if message.Content == messageContent {
+		return message, nil
+	}
+
+	revision := &models.MessageRevision{
+		MessageID: message.ID,
+		Content:   message.Content,
+		EditedBy:  editorID,
+	}
+
+	editedAt := time.Now()
+	message.Content = messageContent
+	message.EditedAt = &editedAt
+
+	if err := s.messageRepo.UpdateContent(message, revision); err != nil {
+		return nil, err
+	}
+
+	s.inRoomOrder(roomID, func() {
+		s.hub.BroadcastMessageEdited(roomID, message, s.recordChange(roomID))
+	})
+
+	return message, nil
+}
+
+func (s *chatService) GetMessageHistory(roomID, messageID, userID string) ([]models.MessageRevision, error) {
+	if _, err := s.requireMember(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	message, err := s.findRoomMessage(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.messageRepo.FindRevisions(message.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve message history: %w", err)
+	}
+	return revisions, nil
+}
+
+// DeleteMessage retracts a message on behalf of its sender, a room owner or
+// admin, or a global moderator
+func (s *chatService) DeleteMessage(roomID, messageID, userID string) error {
+	member, err := s.memberRepo.Find(roomID, userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if member == nil && !s.moderators[userID] {
+		return ErrNotRoomMember
+	}
+	if err := s.requireActiveRoom(roomID); err != nil {
+		return err
+	}
+
+	message, err := s.findRoomMessage(roomID, messageID)
+	if err != nil {
+		return err
+	}
+
+	canModerate := s.moderators[userID] || member.CanModerate()
+	if message.SenderID != userID && !canModerate {
+		return ErrForbidden
+	}
+
+	if err := s.messageRepo.SoftDelete(message, userID); err != nil {
+		return err
+	}
+
+	s.inRoomOrder(roomID, func() {
+		s.hub.BroadcastMessageDeleted(roomID, message, s.recordChange(roomID))
+	})
+
+	return nil
+}
+
+// GetThread returns a top-level message and its replies
+func (s *chatService) GetThread(roomID, messageID, userID string) (*models.Message, []models.Message, error) {
+	if _, err := s.requireMember(roomID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	parent, err := s.findRoomMessage(roomID, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Opening a reply shows the whole thread it belongs to
+	if parent.ParentID != nil {
+		if parent, err = s.findRoomMessage(roomID, *parent.ParentID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	replies, err := s.messageRepo.FindReplies(parent.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve thread: %w", err)
+	}
+
+	parent.ReplyCount = len(replies)
+	thread := append([]models.Message{*parent}, replies...)
+	if err := s.attachReactions(thread); err != nil {
+		return nil, nil, err
+	}
+	hideDeletedContent(thread)
+	return &thread[0], thread[1:], nil
+}
+
+func (s *chatService) AddReaction(roomID, messageID, userID, emoji string) ([]models.ReactionCount, error) {
+	emoji, err := normalizeEmoji(emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.requireMember(roomID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.requireActiveRoom(roomID); err != nil {
+		return nil, err
+	}
+
+	message, err := s.findRoomMessage(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	reaction := &models.Reaction{
+		MessageID: message.ID,
+		UserID:    userID,
+		Emoji:     emoji,
+	}
+	if err := s.reactionRepo.Add(reaction); err != nil {
+		return nil, err
+	}
+
+	return s.reactionsChanged(message)
+}
+
+func (s *chatService) RemoveReaction(roomID, messageID, userID, emoji string) ([]models.ReactionCount, error) {
+	emoji, err := normalizeEmoji(emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.requireMember(roomID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.requireActiveRoom(roomID); err != nil {
+		return nil, err
+	}
+
+	message, err := s.findRoomMessage(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.reactionRepo.Remove(message.ID, userID, emoji); err != nil {
+		return nil, err
+	}
+
+	return s.reactionsChanged(message)
+}
+
+// reactionsChanged reloads a message's reaction counts and broadcasts them
+func (s *chatService) reactionsChanged(message *models.Message) ([]models.ReactionCount, error) {
+	counts, err := s.reactionRepo.CountByMessages([]string{message.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	reactions := counts[message.ID]
+	if reactions == nil {
+		reactions = []models.ReactionCount{}
+	}
+
+	s.inRoomOrder(message.RoomID, func() {
+		s.hub.BroadcastReactionUpdated(message.RoomID, message.ID, reactions, s.recordChange(message.RoomID))
+	})
+
+	return reactions, nil
+}
+
+// attachReactions fills in the aggregated reactions of each message
+func (s *chatService) attachReactions(messages []models.Message) error {
+	messageIDs := make([]string, len(messages))
+	for i := range messages {
+		messageIDs[i] = messages[i].ID
+	}
+
+	counts, err := s.reactionRepo.CountByMessages(messageIDs)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve reactions: %w", err)
+	}
+
+	for i := range messages {
+		messages[i].Reactions = counts[messages[i].ID]
+	}
+	return nil
+}
+
+// normalizeEmoji accepts a shortcode with or without surrounding colons
+func normalizeEmoji(emoji string) (string, error) {
+	emoji = strings.ToLower(strings.Trim(strings.TrimSpace(emoji), ":"))
+	if !emojiShortcode.MatchString(emoji) {
+		return "", ErrInvalidEmoji
+	}
+	return emoji, nil
+}
+
+// hideDeletedContent replaces the content of deleted messages with a tombstone
+func hideDeletedContent(messages []models.Message) {
+	for i := range messages {
+		if messages[i].IsDeleted() {
+			messages[i].Content = models.MessageTombstone
+			messages[i].Reactions = nil
+		}
+	}
+}
+
+// findRoomMessage loads a message and makes sure it belongs to the given room
+func (s *chatService) findRoomMessage(roomID, messageID string) (*models.Message, error) {
+	message, err := s.messageRepo.FindByID(messageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+
+	if message.RoomID != roomID {
+		return nil, ErrMessageNotFound
+	}
+	return message, nil
+}
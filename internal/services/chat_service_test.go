@@ -0,0 +1,147 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"github.com/c0sm0thecoder/cli-chat-app/internal/repositories"
+)
+
+func TestDecodeCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2025, 3, 14, 15, 9, 26, 535897932, time.FixedZone("CET", 3600))
+	message := models.Message{ID: "3f8b2c1e-9a4d-4e5f-8c7b-1d2e3f4a5b6c", CreatedAt: createdAt}
+
+	cursor, err := decodeCursor(encodeCursor(message))
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if cursor.ID != message.ID {
+		t.Errorf("ID = %q, want %q", cursor.ID, message.ID)
+	}
+	if !cursor.CreatedAt.Equal(createdAt) {
+		t.Errorf("CreatedAt = %v, want %v", cursor.CreatedAt, createdAt)
+	}
+}
+
+func TestDecodeCursorRejectsMalformed(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("2025-03-14T15:09:26Z|id"))},
+		{"no separator", encode("2025-03-14T15:09:26Z")},
+		{"no id", encode("2025-03-14T15:09:26Z|")},
+		{"bad timestamp", encode("yesterday|3f8b2c1e")},
+		{"no timestamp", encode("|3f8b2c1e")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cursor, err := decodeCursor(tt.cursor); err != ErrInvalidCursor {
+				t.Errorf("decodeCursor(%q) = %+v, %v; want ErrInvalidCursor", tt.cursor, cursor, err)
+			}
+		})
+	}
+}
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"none", "hello everyone", nil},
+		{"single", "@alice hi", []string{"alice"}},
+		{"several", "hey @alice and @bob", []string{"alice", "bob"}},
+		{"after punctuation", "(@alice),@bob", []string{"alice", "bob"}},
+		{"trailing punctuation", "thanks @alice. ask @bob-", []string{"alice", "bob"}},
+		{"dots and dashes inside", "cc @jane.doe @x-y", []string{"jane.doe", "x-y"}},
+		{"duplicates", "@alice @alice @alice", []string{"alice"}},
+		{"email address", "mail alice@example.com", nil},
+		{"double at", "@@alice", nil},
+		{"bare at", "@ alone and @.", nil},
+		{"underscores and digits", "@user_01", []string{"user_01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMentions(tt.content)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMentions(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMentionsCapsUsers(t *testing.T) {
+	var content strings.Builder
+	for i := 0; i < maxMentionsPerMessage+5; i++ {
+		fmt.Fprintf(&content, "@user%d ", i)
+	}
+
+	got := parseMentions(content.String())
+	if len(got) != maxMentionsPerMessage {
+		t.Fatalf("parsed %d mentions, want %d", len(got), maxMentionsPerMessage)
+	}
+	if got[0] != "user0" || got[len(got)-1] != fmt.Sprintf("user%d", maxMentionsPerMessage-1) {
+		t.Errorf("kept %q..%q, want the first %d", got[0], got[len(got)-1], maxMentionsPerMessage)
+	}
+}
+
+// createdRooms records the rooms created through it. Its other methods are
+// not implemented.
+type createdRooms struct {
+	repositories.RoomRepository
+	rooms []*models.Room
+}
+
+func (r *createdRooms) CreateWithMembers(room *models.Room, members []models.RoomMember) error {
+	r.rooms = append(r.rooms, room)
+	return nil
+}
+
+func TestCreateRoomValidatesName(t *testing.T) {
+	tests := []struct {
+		name     string
+		roomName string
+		wantName string
+		wantErr  error
+	}{
+		{"plain", "General", "General", nil},
+		{"trimmed", "  General \t", "General", nil},
+		{"empty", "", "", ErrEmptyRoomName},
+		{"whitespace only", " \t\n ", "", ErrEmptyRoomName},
+		{"longest", strings.Repeat("é", MaxRoomNameLength), strings.Repeat("é", MaxRoomNameLength), nil},
+		{"too long", strings.Repeat("a", MaxRoomNameLength+1), "", ErrRoomNameTooLong},
+		{"too long once trimmed", " " + strings.Repeat("a", MaxRoomNameLength+1) + " ", "", ErrRoomNameTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &createdRooms{}
+			s := &chatService{roomRepo: repo}
+
+			room, err := s.CreateRoom(tt.roomName, "alice", false)
+			if err != tt.wantErr {
+				t.Fatalf("CreateRoom(%q) error = %v, want %v", tt.roomName, err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.rooms) != 0 {
+					t.Errorf("CreateRoom(%q) stored a room after failing", tt.roomName)
+				}
+				return
+			}
+			if room.Name != tt.wantName || len(repo.rooms) != 1 || repo.rooms[0].Name != tt.wantName {
+				t.Errorf("CreateRoom(%q) stored name %q, want %q", tt.roomName, room.Name, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"github.com/c0sm0thecoder/cli-chat-app/internal/totp"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication has not been set up")
+	ErrInvalidCode          = errors.New("invalid two-factor code")
+	ErrCodeRequired         = errors.New("a two-factor code is required")
+	ErrInvalidChallenge     = errors.New("invalid or expired login challenge")
+)
+
+const (
+	// TOTPIssuer names this service in authenticator apps
+	TOTPIssuer = "CLI Chat"
+	// LoginChallengeTTL is how long the second step of a login may take
+	LoginChallengeTTL = 5 * time.Minute
+	// maxChallengeAttempts is how many codes may be tried for one login
+	maxChallengeAttempts = 5
+	// recoveryCodeCount is how many recovery codes a user gets
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet leaves out characters that are easy to confuse
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// TwoFactorStatus tells whether a user has two-factor authentication on
+type TwoFactorStatus struct {
+	Enabled           bool  `json:"enabled"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+// TOTPEnrollment is what a user adds to their authenticator app, by scanning
+// the URI or typing the secret
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// CompleteLogin finishes a login of a user with two-factor authentication,
+// taking an authenticator code or a recovery code
+func (s *authService) CompleteLogin(challenge, code string) (*TokenPair, error) {
+	pending, err := s.twoFactorRepo.FindChallengeByHash(hashToken(challenge))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+	if pending.UsedAt != nil || !time.Now().Before(pending.ExpiresAt) {
+		return nil, ErrInvalidChallenge
+	}
+
+	// Each challenge allows only a few guesses
+	allowed, err := s.twoFactorRepo.RecordAttempt(pending.ID, maxChallengeAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrInvalidChallenge
+	}
+
+	user, err := s.findUser(pending.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSecondFactor(user, code); err != nil {
+		log.Printf("Login error - invalid two-factor code for user: %s", user.UserName)
+		return nil, err
+	}
+
+	used, err := s.twoFactorRepo.MarkChallengeUsed(pending.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidChallenge
+	}
+
+	log.Printf("Login successful for user: %s, second factor verified", user.UserName)
+	return s.startSession(user.UserName, DeviceInfo{
+		Label:         pending.DeviceLabel,
+		ClientVersion: pending.ClientVersion,
+		IPAddress:     pending.IPAddress,
+	})
+}
+
+// TwoFactorStatus tells whether the user has two-factor authentication on and
+// how many recovery codes they have left
+func (s *authService) TwoFactorStatus(userID string) (*TwoFactorStatus, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &TwoFactorStatus{Enabled: user.TwoFactorEnabled()}
+	if status.Enabled {
+		if status.RecoveryCodesLeft, err = s.twoFactorRepo.CountRecoveryCodes(userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// EnrollTOTP gives the user a new secret for their authenticator. It takes
+// effect once ActivateTOTP confirms the authenticator produces its codes.
+func (s *authService) EnrollTOTP(userID string) (*TOTPEnrollment, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.SetTOTPSecret(userID, secret); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(TOTPIssuer, userID, secret),
+	}, nil
+}
+
+// ActivateTOTP turns two-factor authentication on once the user sends a code
+// of their new authenticator, and returns their recovery codes. They are only
+// shown this once.
+func (s *authService) ActivateTOTP(userID, code string) ([]string, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactorRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.EnableTOTP(userID, step); err != nil {
+		return nil, err
+	}
+	log.Printf("Two-factor authentication enabled for user: %s", userID)
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off, given the password and a
+// current authenticator or recovery code
+func (s *authService) DisableTOTP(userID, password, code string) error {
+	user, err := s.checkPassword(userID, password)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+	if err := s.checkSecondFactor(user, code); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.DisableTOTP(userID); err != nil {
+		return err
+	}
+	if err := s.twoFactorRepo.DeleteRecoveryCodes(userID); err != nil {
+		return err
+	}
+	log.Printf("Two-factor authentication disabled for user: %s", userID)
+	return nil
+}
+
+// confirmIdentity returns the user if the password is theirs and, when they
+// have two-factor authentication on, the code is a current authenticator or
+// unused recovery code. It guards changes a stolen access token and password
+// alone must not make.
+func (s *authService) confirmIdentity(userID, password, code string) (*models.User, error) {
+	user, err := s.checkPassword(userID, password)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TwoFactorEnabled() {
+		return user, nil
+	}
+	if code == "" {
+		return nil, ErrCodeRequired
+	}
+	if err := s.checkSecondFactor(user, code); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// checkSecondFactor accepts a current authenticator code that was not used
+// before, or an unused recovery code, which is then spent
+func (s *authService) checkSecondFactor(user *models.User, code string) error {
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now()); ok {
+		fresh, err := s.userRepo.UseTOTPStep(user.UserName, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	used, err := s.twoFactorRepo.UseRecoveryCode(user.UserName, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+	log.Printf("Recovery code used by user: %s", user.UserName)
+	return nil
+}
+
+// createChallenge stores the pending second step of a login and returns the
+// token the client completes it with
+func (s *authService) createChallenge(userID string, device DeviceInfo) (string, error) {
+	challenge, err := gonanoid.New(43)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate login challenge: %w", err)
+	}
+	err = s.twoFactorRepo.CreateChallenge(&models.LoginChallenge{
+		UserID:        userID,
+		TokenHash:     hashToken(challenge),
+		DeviceLabel:   truncate(device.Label, 100),
+		ClientVersion: truncate(device.ClientVersion, 50),
+		IPAddress:     truncate(device.IPAddress, 64),
+		ExpiresAt:     time.Now().Add(LoginChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// findUser looks a user up by username
+func (s *authService) findUser(userID string) (*models.User, error) {
+	user, err := s.userRepo.FindByUsername(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// generateRecoveryCodes returns new recovery codes, formatted as xxxxx-xxxxx,
+// with the hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := gonanoid.Generate(recoveryCodeAlphabet, 10)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode drops the separator and case a recovery code may be
+// typed with
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
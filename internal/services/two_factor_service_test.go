@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"github.com/c0sm0thecoder/cli-chat-app/internal/repositories"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oneUser holds a single user. Its other methods are not implemented.
+type oneUser struct {
+	repositories.UserRepository
+	user *models.User
+}
+
+func (r *oneUser) FindByUsername(username string) (*models.User, error) {
+	if username != r.user.UserName {
+		return nil, ErrUserNotFound
+	}
+	return r.user, nil
+}
+
+// oneRecoveryCode accepts a single recovery code once. Its other methods are
+// not implemented.
+type oneRecoveryCode struct {
+	repositories.TwoFactorRepository
+	hash string
+	used bool
+}
+
+func (r *oneRecoveryCode) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	if r.used || codeHash != r.hash {
+		return false, nil
+	}
+	r.used = true
+	return true, nil
+}
+
+func TestConfirmIdentity(t *testing.T) {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+	enabledAt := time.Now()
+
+	tests := []struct {
+		name      string
+		twoFactor bool
+		password  string
+		code      string
+		wantErr   error
+	}{
+		{"password only, two-factor off", false, "hunter2", "", nil},
+		{"wrong password, two-factor off", false, "wrong", "", ErrInvalidCredentials},
+		{"password only, two-factor on", true, "hunter2", "", ErrCodeRequired},
+		{"wrong password with code", true, "wrong", "abcde-fghij", ErrInvalidCredentials},
+		{"wrong code", true, "hunter2", "000000", ErrInvalidCode},
+		{"recovery code", true, "hunter2", "abcde-fghij", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{UserName: "alice", PasswordHash: string(hash), TOTPSecret: secret}
+			if tt.twoFactor {
+				user.TOTPEnabledAt = &enabledAt
+			}
+			s := &authService{
+				userRepo:      &oneUser{user: user},
+				twoFactorRepo: &oneRecoveryCode{hash: hashToken(normalizeRecoveryCode("abcde-fghij"))},
+			}
+
+			if _, err := s.confirmIdentity("alice", tt.password, tt.code); err != tt.wantErr {
+				t.Errorf("confirmIdentity = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
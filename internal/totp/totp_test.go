@@ -0,0 +1,108 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, base32 encoded
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateRFC6238Vectors(t *testing.T) {
+	// The RFC lists eight-digit codes; six-digit codes are their last six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			at := time.Unix(tt.unix, 0)
+			step, ok := Validate(rfcSecret, tt.code, at)
+			if !ok {
+				t.Fatalf("Validate(%q) at %d rejected the code", tt.code, tt.unix)
+			}
+			if want := tt.unix / 30; step != want {
+				t.Errorf("step = %d, want %d", step, want)
+			}
+		})
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	const code = "005924" // Step 41152263, from 1234567890 to 1234567919
+	step := int64(1234567890 / 30)
+
+	tests := []struct {
+		name   string
+		unix   int64
+		wantOK bool
+	}{
+		{"same step", 1234567919, true},
+		{"one step later", 1234567890 + 30, true},
+		{"one step earlier", 1234567890 - 30, true},
+		{"two steps later", 1234567890 + 60, false},
+		{"two steps earlier", 1234567890 - 60, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(rfcSecret, code, time.Unix(tt.unix, 0))
+			if ok != tt.wantOK {
+				t.Fatalf("Validate at %d = %v, want %v", tt.unix, ok, tt.wantOK)
+			}
+			// The step is the code's own, so a replay in the next step is caught
+			if ok && got != step {
+				t.Errorf("step = %d, want %d", got, step)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsMalformedInput(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		wantOK bool
+	}{
+		{"spaces in code", rfcSecret, "005 924", true},
+		{"lowercase secret", strings.ToLower(rfcSecret), "005924", true},
+		{"wrong code", rfcSecret, "005925", false},
+		{"eight digits", rfcSecret, "89005924", false},
+		{"too short", rfcSecret, "05924", false},
+		{"empty code", rfcSecret, "", false},
+		{"secret not base32", "not a secret!", "005924", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := Validate(tt.secret, tt.code, at); ok != tt.wantOK {
+				t.Errorf("Validate(%q, %q) = %v, want %v", tt.secret, tt.code, ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecretValidates(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != secretSize {
+		t.Fatalf("secret %q decodes to %d bytes, %v; want %d", secret, len(key), err, secretSize)
+	}
+
+	at := time.Now()
+	code := generate(key, at.Unix()/int64(Period.Seconds()))
+	if _, ok := Validate(secret, code, at); !ok {
+		t.Errorf("Validate rejected the current code %q of a new secret", code)
+	}
+}
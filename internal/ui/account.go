@@ -0,0 +1,206 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// errInvalidResetToken means the server refused a password reset token
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// showAccountModal offers the actions on our own account
+func showAccountModal() {
+	modal := tview.NewModal().
+		SetText("Account: " + username).
+		AddButtons([]string{"Change Password", "Two-Factor", "Delete Account", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			pages.RemovePage("modal")
+			switch buttonLabel {
+			case "Change Password":
+				showChangePasswordForm()
+			case "Two-Factor":
+				showTwoFactorSettings()
+			case "Delete Account":
+				showDeleteAccountForm()
+			}
+		})
+
+	modal.SetBorder(true).
+		SetTitle(" Account ").
+		SetTitleAlign(tview.AlignCenter)
+
+	pages.AddPage("modal", modal, false, true)
+}
+
+// showChangePasswordForm asks for the current and a new password, and a
+// two-factor code for accounts that have two-factor authentication on
+func showChangePasswordForm() {
+	form := tview.NewForm()
+	form.AddPasswordField("Current Password", "", 30, '*', nil)
+	form.AddPasswordField("New Password", "", 30, '*', nil)
+	form.AddPasswordField("Confirm Password", "", 30, '*', nil)
+	form.AddInputField("2FA Code (if on)", "", 20, nil, nil)
+	form.AddButton("Change", func() {
+		oldPassword := form.GetFormItem(0).(*tview.InputField).GetText()
+		newPassword := form.GetFormItem(1).(*tview.InputField).GetText()
+		confirmPassword := form.GetFormItem(2).(*tview.InputField).GetText()
+		code := strings.TrimSpace(form.GetFormItem(3).(*tview.InputField).GetText())
+		if oldPassword == "" || newPassword == "" {
+			showInfoModal("Error", "Passwords cannot be empty")
+			return
+		}
+		if newPassword != confirmPassword {
+			showInfoModal("Error", "Passwords do not match")
+			return
+		}
+
+		body := map[string]string{"old_password": oldPassword, "new_password": newPassword, "code": code}
+		if err := apiCall("PUT", "/account/password", body, nil); err != nil {
+			showInfoModal("Error", "Failed to change password: "+err.Error())
+			return
+		}
+		pages.RemovePage("accountForm")
+		showInfoModal("Password Changed", "Your password was changed and your other sessions were logged out")
+	})
+	form.AddButton("Cancel", func() {
+		pages.RemovePage("accountForm")
+	})
+
+	showAccountForm(form, " Change Password ", 15)
+}
+
+// showDeleteAccountForm asks for the password, and a two-factor code for
+// accounts that have two-factor authentication on, before deleting our account
+func showDeleteAccountForm() {
+	form := tview.NewForm()
+	form.AddTextView("", "Your messages stay in their rooms as [deleted]. This cannot be undone.", 40, 2, true, false)
+	form.AddPasswordField("Password", "", 30, '*', nil)
+	form.AddInputField("2FA Code (if on)", "", 20, nil, nil)
+	form.AddButton("Delete", func() {
+		password := form.GetFormItem(1).(*tview.InputField).GetText()
+		code := strings.TrimSpace(form.GetFormItem(2).(*tview.InputField).GetText())
+		if password == "" {
+			showInfoModal("Error", "Password cannot be empty")
+			return
+		}
+
+		body := map[string]string{"password": password, "code": code}
+		if err := apiCall("DELETE", "/account", body, nil); err != nil {
+			showInfoModal("Error", "Failed to delete account: "+err.Error())
+			return
+		}
+		pages.RemovePage("accountForm")
+		closeWebSocket()
+		clearSession()
+		username = ""
+		pages.SwitchToPage("login")
+		showInfoModal("Account Deleted", "Your account was deleted")
+	})
+	form.AddButton("Cancel", func() {
+		pages.RemovePage("accountForm")
+	})
+
+	showAccountForm(form, " Delete Account ", 13)
+}
+
+// showForgotPasswordForm asks the server to send a password reset token
+func showForgotPasswordForm() {
+	form := tview.NewForm()
+	form.AddInputField("Username", "", 30, nil, nil)
+	form.AddButton("Send Token", func() {
+		name := form.GetFormItem(0).(*tview.InputField).GetText()
+		if name == "" {
+			showInfoModal("Error", "Username cannot be empty")
+			return
+		}
+
+		if err := publicCall("/password/forgot", map[string]string{"username": name}); err != nil {
+			showInfoModal("Error", "Failed to request a reset: "+err.Error())
+			return
+		}
+		pages.RemovePage("accountForm")
+		showResetPasswordForm()
+		showInfoModal("Reset Requested", "If the account exists, a reset token was sent to the server administrator")
+	})
+	form.AddButton("I Have a Token", func() {
+		pages.RemovePage("accountForm")
+		showResetPasswordForm()
+	})
+	form.AddButton("Cancel", func() {
+		pages.RemovePage("accountForm")
+	})
+
+	showAccountForm(form, " Forgot Password ", 9)
+}
+
+// showResetPasswordForm sets a new password with a reset token
+func showResetPasswordForm() {
+	form := tview.NewForm()
+	form.AddInputField("Reset Token", "", 45, nil, nil)
+	form.AddPasswordField("New Password", "", 30, '*', nil)
+	form.AddPasswordField("Confirm Password", "", 30, '*', nil)
+	form.AddButton("Reset", func() {
+		token := form.GetFormItem(0).(*tview.InputField).GetText()
+		newPassword := form.GetFormItem(1).(*tview.InputField).GetText()
+		confirmPassword := form.GetFormItem(2).(*tview.InputField).GetText()
+		if token == "" || newPassword == "" {
+			showInfoModal("Error", "Token and password cannot be empty")
+			return
+		}
+		if newPassword != confirmPassword {
+			showInfoModal("Error", "Passwords do not match")
+			return
+		}
+
+		if err := publicCall("/password/reset", map[string]string{"token": token, "new_password": newPassword}); err != nil {
+			showInfoModal("Error", "Failed to reset password: "+err.Error())
+			return
+		}
+		pages.RemovePage("accountForm")
+		showInfoModal("Password Reset", "You can now log in with your new password")
+	})
+	form.AddButton("Cancel", func() {
+		pages.RemovePage("accountForm")
+	})
+
+	showAccountForm(form, " Reset Password ", 13)
+}
+
+// showAccountForm shows one of the account forms in the middle of the screen
+func showAccountForm(form *tview.Form, title string, height int) {
+	form.SetBorder(true).
+		SetTitle(title).
+		SetTitleAlign(tview.AlignCenter)
+
+	pages.AddPage("accountForm", tview.NewGrid().
+		SetColumns(0, 64, 0).
+		SetRows(0, height, 0).
+		AddItem(form, 1, 1, 1, 1, 0, 0, true), true, true)
+}
+
+// publicCall posts to an API endpoint that needs no login
+func publicCall(path string, body interface{}) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to prepare request: %v", err)
+	}
+
+	resp, err := sendAPIRequest("POST", path, jsonData, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errInvalidResetToken
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return apiError(resp)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+)
+
+// wsEvent is a frame received from the server over the WebSocket
+type wsEvent struct {
+	Type       string                 `json:"type"`
+	ClientID   string                 `json:"client_id,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	ID         string                 `json:"id,omitempty"`
+	RoomID     string                 `json:"room_id,omitempty"`
+	RoomName   string                 `json:"room_name,omitempty"`
+	SenderID   string                 `json:"sender_id,omitempty"`
+	ParentID   *string                `json:"parent_id,omitempty"`
+	Username   string                 `json:"username,omitempty"`
+	Content    string                 `json:"content,omitempty"`
+	CreatedAt  time.Time              `json:"created_at,omitempty"`
+	EditedAt   *time.Time             `json:"edited_at,omitempty"`
+	Seq        int64                  `json:"seq,omitempty"`
+	MessageID  string                 `json:"message_id,omitempty"`
+	Reactions  []models.ReactionCount `json:"reactions,omitempty"`
+	Name       string                 `json:"name,omitempty"`
+	Topic      string                 `json:"topic,omitempty"`
+	Code       string                 `json:"code,omitempty"`
+	ArchivedAt *time.Time             `json:"archived_at,omitempty"`
+	UpdatedBy  string                 `json:"updated_by,omitempty"`
+	Reason     string                 `json:"reason,omitempty"`
+	Status     string                 `json:"status,omitempty"`
+	LastSeen   *time.Time             `json:"last_seen,omitempty"`
+}
+
+// apiRequest sends an authenticated JSON request to the API server. When the
+// access token has expired, it is refreshed and the request sent again.
+func apiRequest(method, path string, body interface{}) (*http.Response, error) {
+	var jsonData []byte
+	if body != nil {
+		var err error
+		jsonData, err = json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare request: %v", err)
+		}
+	}
+
+	token := currentToken()
+	resp, err := sendAPIRequest(method, path, jsonData, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	resp.Body.Close()
+	if err := refreshSession(token); err != nil {
+		return nil, err
+	}
+	return sendAPIRequest(method, path, jsonData, currentToken())
+}
+
+// sendAPIRequest sends one request with the given access token
+func sendAPIRequest(method, path string, jsonData []byte, token string) (*http.Response, error) {
+	var reader io.Reader
+	if jsonData != nil {
+		reader = bytes.NewReader(jsonData)
+	}
+
+	// Create HTTP request
+	req, err := http.NewRequest(method, apiBaseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	// Send request
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("connection error: %v", err)
+	}
+	return resp, nil
+}
+
+// apiError turns an unsuccessful response into an error using the server's message
+func apiError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errSessionExpired
+	}
+
+	respBody, _ := io.ReadAll(resp.Body)
+	message := strings.TrimSpace(string(respBody))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return fmt.Errorf("%s (status %d)", message, resp.StatusCode)
+}
+
+// apiCall sends an authenticated request and decodes a successful response
+// into result, if given
+func apiCall(method, path string, body, result interface{}) error {
+	resp, err := apiRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return apiError(resp)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
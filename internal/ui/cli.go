@@ -3,34 +3,40 @@ package ui
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
 	"github.com/gdamore/tcell/v2"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/rivo/tview"
 )
 
 var (
-	app             *tview.Application
-	pages           *tview.Pages
-	apiBaseURL      string
-	wsBaseURL       string  // WebSocket URL
-	authToken       string
-	username        string
-	currentRoomID   string
-	currentRoomCode string
-	chatDisplay     *tview.TextView
-	messageInput    *tview.InputField
-	roomCodeInput   *tview.InputField
-	wsConn          *websocket.Conn // WebSocket connection
-	stopWebsocket   chan struct{}   // Channel to signal stopping the WebSocket
+	app                 *tview.Application
+	pages               *tview.Pages
+	apiBaseURL          string
+	wsBaseURL           string // WebSocket URL
+	authToken           string
+	username            string
+	currentRoomID       string
+	currentRoomCode     string
+	currentRoomName     string
+	currentRoomTopic    string
+	currentRoomArchived bool
+	chatDisplay         *tview.TextView
+	messageInput        *tview.InputField
+	roomCodeInput       *tview.InputField
+	wsConn              *websocket.Conn           // WebSocket connection
+	stopWebsocket       chan struct{}             // Channel to signal stopping the WebSocket
+	pendingMessages     = make(map[string]string) // Messages sent over the WebSocket awaiting an ack, by client ID
 )
 
 // Define global form variables
@@ -75,10 +81,26 @@ func StartCLI(serverURL string) {
 			app.Stop()
 			return nil
 		} else if event.Key() == tcell.KeyEsc {
-			// ESC key returns to login from any page
+			// ESC key leaves threads, messages shown around a search hit, search, mentions, direct messages, archived rooms and sessions, and returns to login from any other page
 			if pages.HasPage("modal") {
 				pages.RemovePage("modal")
-			} else if name, _ := pages.GetFrontPage(); name != "login" {
+			} else if pages.HasPage("accountForm") {
+				pages.RemovePage("accountForm")
+			} else if name, _ := pages.GetFrontPage(); name == "thread" {
+				closeThread()
+			} else if name == "context" {
+				closeMessageContext()
+			} else if name == "search" {
+				closeSearch()
+			} else if name == "mentions" {
+				closeMentions()
+			} else if name == "directs" {
+				closeDirectMessages()
+			} else if name == "archived" {
+				closeArchivedRooms()
+			} else if name == "sessions" {
+				closeSessions()
+			} else if name != "login" {
 				pages.SwitchToPage("login")
 			}
 			return nil
@@ -92,12 +114,7 @@ func StartCLI(serverURL string) {
 	}
 
 	// Clean up when app exits
-	if wsConn != nil {
-		wsConn.Close()
-		if stopWebsocket != nil {
-			close(stopWebsocket)
-		}
-	}
+	closeWebSocket()
 }
 
 // setupLoginForm creates the login form
@@ -117,25 +134,28 @@ func setupLoginForm() {
 		}
 		
 		// Attempt login
-		token, err := login(usernameInput, password)
+		result, err := login(usernameInput, password)
 		if err != nil {
 			showInfoModal("Login Failed", err.Error())
 			return
 		}
-		
-		// Store credentials
-		authToken = token
-		username = usernameInput
-		
-		// Navigate to rooms page
-		setupRoomsPage()
-		pages.SwitchToPage("rooms")
+
+		// Accounts with two-factor authentication need a code as well
+		if result.TwoFactorRequired {
+			showTwoFactorLoginForm(usernameInput, result.Challenge)
+			return
+		}
+		finishLogin(usernameInput, result.tokenPair)
 	})
 	
 	loginForm.AddButton("Sign Up", func() {
 		// Switch to signup page
 		pages.SwitchToPage("signup")
 	})
+
+	loginForm.AddButton("Forgot Password", func() {
+		showForgotPasswordForm()
+	})
 	
 	loginForm.AddButton("Quit", func() {
 		app.Stop()
@@ -293,20 +313,40 @@ func registerUser(username, password string) error {
 
 // setupRoomsPage creates the rooms page with the current username
 func setupRoomsPage() {
+	roomsList = tview.NewList()
 	roomsPage := tview.NewFlex().
 		SetDirection(tview.FlexRow).
 		AddItem(tview.NewTextView().
 			SetTextAlign(tview.AlignCenter).
 			SetText("Welcome to Chat App, " + username), 3, 1, false).
-		AddItem(tview.NewList().
+		AddItem(roomsList.
 			AddItem("Create Room", "Create a new chat room", 'c', func() {
 				showCreateRoomModal()
 			}).
 			AddItem("Join Room", "Join an existing room", 'j', func() {
 				showJoinRoomModal()
 			}).
+			AddItem("Search Messages", "Find messages in your rooms", 's', func() {
+				showSearchPage("")
+			}).
+			AddItem("Mentions", "Messages that mentioned you", 'm', func() {
+				showMentionsPage()
+			}).
+			AddItem("Direct Messages", "Private conversations with other users", 'd', func() {
+				showDirectMessagesPage()
+			}).
+			AddItem("Archived Rooms", "Read the history of archived rooms", 'a', func() {
+				showArchivedRoomsPage()
+			}).
+			AddItem("Sessions", "Devices logged in to your account", 'v', func() {
+				showSessionsPage()
+			}).
+			AddItem("Account", "Change your password or delete your account", 'u', func() {
+				showAccountModal()
+			}).
 			AddItem("Logout", "Return to login screen", 'l', func() {
-				authToken = ""
+				closeWebSocket()
+				logout()
 				username = ""
 				pages.SwitchToPage("login")
 			}), 0, 1, true)
@@ -314,26 +354,48 @@ func setupRoomsPage() {
 	roomsPage.SetBorder(true).
 		SetTitle(" Chat Rooms ").
 		SetTitleAlign(tview.AlignCenter)
+	roomsActionCount = roomsList.GetItemCount()
 
 	pages.AddPage("rooms", roomsPage, true, false)
 }
 
+// loginResult is the server's answer to a login: the tokens of the new
+// session, or a challenge to complete with a two-factor code
+type loginResult struct {
+	tokenPair
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	Challenge         string `json:"challenge"`
+}
+
+// finishLogin stores the tokens of a login and opens the rooms page
+func finishLogin(name string, pair tokenPair) {
+	// Store credentials
+	setSession(pair)
+	username = name
+
+	// Navigate to rooms page
+	setupRoomsPage()
+	showRoomsPage()
+}
+
 // login sends a login request to the API
-func login(username, password string) (string, error) {
+func login(username, password string) (*loginResult, error) {
 	// Prepare request data
 	reqData := map[string]string{
-		"username": username,
-		"password": password,
+		"username":       username,
+		"password":       password,
+		"device_label":   deviceLabel(),
+		"client_version": clientVersion(),
 	}
 	jsonData, err := json.Marshal(reqData)
 	if err != nil {
-		return "", fmt.Errorf("failed to prepare request: %v", err)
+		return nil, fmt.Errorf("failed to prepare request: %v", err)
 	}
 
 	// Create HTTP request
 	req, err := http.NewRequest("POST", apiBaseURL+"/login", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
@@ -341,32 +403,35 @@ func login(username, password string) (string, error) {
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("connection error: %v", err)
+		return nil, fmt.Errorf("connection error: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Handle non-200 responses
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusUnauthorized {
-			return "", fmt.Errorf("invalid username or password")
+			return nil, fmt.Errorf("invalid username or password")
 		}
-		return "", fmt.Errorf("server error (status %d)", resp.StatusCode)
+		return nil, fmt.Errorf("server error (status %d)", resp.StatusCode)
 	}
 
 	// Parse response
-	var respData struct {
-		Token string `json:"token"`
-	}
-	
-	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-		return "", fmt.Errorf("failed to parse response: %v", err)
+	var result loginResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
 	}
 
-	if respData.Token == "" {
-		return "", fmt.Errorf("no token received from server")
+	if result.TwoFactorRequired {
+		if result.Challenge == "" {
+			return nil, fmt.Errorf("no login challenge received from server")
+		}
+		return &result, nil
+	}
+	if result.AccessToken == "" || result.RefreshToken == "" {
+		return nil, fmt.Errorf("no token received from server")
 	}
 
-	return respData.Token, nil
+	return &result, nil
 }
 
 // showInfoModal displays an information modal with a message
@@ -389,15 +454,17 @@ func showInfoModal(title, message string) {
 func showCreateRoomModal() {
 	form := tview.NewForm()
 	form.AddInputField("Room Name", "", 30, nil, nil)
+	form.AddCheckbox("Private (invite only)", false, nil)
 	form.AddButton("Create", func() {
 		roomName := form.GetFormItem(0).(*tview.InputField).GetText()
+		private := form.GetFormItem(1).(*tview.Checkbox).IsChecked()
 		if roomName == "" {
 			showInfoModal("Error", "Room name cannot be empty")
 			return
 		}
 		
 		// Create room via API
-		room, err := createRoom(roomName)
+		room, err := createRoom(roomName, private)
 		if err != nil {
 			showInfoModal("Error", "Failed to create room: "+err.Error())
 			return
@@ -428,7 +495,7 @@ func showCreateRoomModal() {
 	
 	pages.AddPage("createRoomModal", tview.NewGrid().
 		SetColumns(0, 40, 0).
-		SetRows(0, 10, 0).
+		SetRows(0, 12, 0).
 		AddItem(form, 1, 1, 1, 1, 0, 0, true), true, true)
 }
 
@@ -436,8 +503,8 @@ func showCreateRoomModal() {
 func showJoinRoomModal() {
 	// Create input field for room code
 	roomCodeInput = tview.NewInputField().
-		SetLabel("Room Code: ").
-		SetFieldWidth(20).
+		SetLabel("Code or Invite: ").
+		SetFieldWidth(32).
 		SetDoneFunc(func(key tcell.Key) {
 			if key == tcell.KeyEnter {
 				code := roomCodeInput.GetText()
@@ -473,7 +540,7 @@ func showJoinRoomModal() {
 		AddItem(tview.NewFlex().
 			SetDirection(tview.FlexColumn).
 			AddItem(nil, 0, 1, false).
-			AddItem(form, 40, 1, true).
+			AddItem(form, 52, 1, true).
 			AddItem(nil, 0, 1, false),
 			10, 1, true).
 		AddItem(nil, 0, 1, false)
@@ -483,29 +550,17 @@ func showJoinRoomModal() {
 }
 
 // createRoom sends a request to create a new room
-func createRoom(roomName string) (*models.Room, error) {
+func createRoom(roomName string, private bool) (*models.Room, error) {
 	// Prepare request data
-	reqData := map[string]string{
-		"name": roomName,
-	}
-	jsonData, err := json.Marshal(reqData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to prepare request: %v", err)
+	reqData := map[string]interface{}{
+		"name":    roomName,
+		"private": private,
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequest("POST", apiBaseURL+"/rooms", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+authToken)
-
 	// Send request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := apiRequest("POST", "/rooms", reqData)
 	if err != nil {
-		return nil, fmt.Errorf("connection error: %v", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -517,7 +572,7 @@ func createRoom(roomName string) (*models.Room, error) {
 
 	// Handle different status codes
 	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, fmt.Errorf("unauthorized: invalid or expired token")
+		return nil, errSessionExpired
 	} else if resp.StatusCode != http.StatusCreated {
 		return nil, fmt.Errorf("server error (status %d)", resp.StatusCode)
 	}
@@ -546,27 +601,29 @@ func createRoom(roomName string) (*models.Room, error) {
 // setupChatRoom creates the chat interface for a specific room
 func setupChatRoom(room *models.Room) {
 	// Close existing WebSocket connection if any
-	if wsConn != nil {
-		wsConn.Close()
-		if stopWebsocket != nil {
-			close(stopWebsocket)
-		}
-	}
+	closeWebSocket()
 
 	// Store current room info
 	currentRoomID = room.ID
 	currentRoomCode = room.Code
-
-	// Display room information
-	roomTitle := fmt.Sprintf(" Room: %s (Code: %s) ", room.Name, room.Code)
+	currentRoomName = room.Name
+	currentRoomTopic = room.Topic
+	currentRoomArchived = room.Archived()
+	threadView = nil
+	threadParentID = ""
+	lastSeq = new(atomic.Int64)
+	receivedIDs = make(map[string]bool)
+	pages.RemovePage("thread")
 
 	// Setup chat display
 	chatDisplay = tview.NewTextView().
-		SetDynamicColors(true).
 		SetChangedFunc(func() {
 			app.Draw()
 		})
-	chatDisplay.SetBorder(true).SetTitle(roomTitle)
+	chatDisplay.SetBorder(true).SetTitle(roomTitle(room.Name, room.Topic, room.Code, room.Archived()))
+	chatView = newMessageView(chatDisplay)
+	chatView.onTop = loadOlderMessages
+	chatDisplay.SetMouseCapture(scrollTopMouse(func() *messageView { return chatView }))
 
 	// Create message input field
 	messageInput = tview.NewInputField().
@@ -575,23 +632,35 @@ func setupChatRoom(room *models.Room) {
 		SetDoneFunc(func(key tcell.Key) {
 			if key == tcell.KeyEnter {
 				content := messageInput.GetText()
-				if content != "" {
-					sendMessage(currentRoomID, content)
+				if strings.HasPrefix(content, "/") {
+					handleCommand(chatView, content)
+					messageInput.SetText("")
+				} else if content != "" {
+					sendMessage(currentRoomID, "", content)
 					messageInput.SetText("")
 				}
 			}
-		})
+		}).
+		SetChangedFunc(inputChanged)
+
+	// Up/Down select messages for commands such as /edit
+	messageInput.SetInputCapture(selectionKeys(func() *messageView { return chatView }))
 
 	// Create layout
 	chatFlex := tview.NewFlex().
 		SetDirection(tview.FlexRow).
-		AddItem(chatDisplay, 0, 1, false).
+		AddItem(tview.NewFlex().
+			AddItem(chatDisplay, 0, 1, false).
+			AddItem(newMemberPane(room.ID), 26, 0, false), 0, 1, false).
+		AddItem(tview.NewFlex().
+			AddItem(newTypingIndicator(), 0, 1, false).
+			AddItem(newConnectionStatus(), 20, 0, false), 1, 0, false).
 		AddItem(messageInput, 3, 1, true)
 
 	// Add keybindings
 	chatFlex.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyEsc {
-			pages.SwitchToPage("rooms")
+			showRoomsPage()
 			return nil
 		}
 		return event
@@ -607,123 +676,248 @@ func setupChatRoom(room *models.Room) {
 	connectWebSocket(room.ID)
 }
 
-// connectWebSocket establishes a WebSocket connection for real-time messages
+// connectWebSocket keeps a WebSocket connection to the room open for
+// real-time messages. When it drops, we reconnect with growing delays and the
+// server replays what we missed.
 func connectWebSocket(roomID string) {
-	// Parse the API base URL to create WebSocket URL
-	apiURL, err := url.Parse(apiBaseURL)
-	if err != nil {
-		return
-	}
-	
-	// Change scheme http -> ws, https -> wss
-	wsScheme := "ws"
-	if apiURL.Scheme == "https" {
-		wsScheme = "wss"
-	}
-	
-	// Create WebSocket URL
-	wsURL := url.URL{
-		Scheme: wsScheme,
-		Host:   apiURL.Host,
-		Path:   strings.TrimSuffix(apiURL.Path, "/api/v1") + "/api/v1/ws",
-	}
-	
-	// Add query parameters for room and auth
-	q := wsURL.Query()
-	q.Set("room_id", roomID)
-	q.Set("token", authToken)
-	wsURL.RawQuery = q.Encode()
-	
-	// Connect to WebSocket server
-	header := http.Header{}
-	header.Add("Authorization", "Bearer "+authToken)
-	wsConnection, _, err := websocket.DefaultDialer.Dial(wsURL.String(), header)
-	if err != nil {
-		return
-	}
-	
-	wsConn = wsConnection
-	stopWebsocket = make(chan struct{})
-	
-	// Start goroutine to handle incoming WebSocket messages
+	stop := make(chan struct{})
+	stopWebsocket = stop
+	startHeartbeat(stop)
+	setConnectionStatus("[yellow]connecting...[-]")
+
+	seq := lastSeq
 	go func() {
-		defer wsConn.Close()
-		
+		delay := reconnectMinDelay
 		for {
+			token := currentToken()
+			conn, err := dialWebSocket(roomID, token, seq.Load())
+			if errors.Is(err, errTokenExpired) {
+				// Try again at once with a fresh token, unless our login is over
+				if err = refreshSession(token); err == nil {
+					conn, err = dialWebSocket(roomID, currentToken(), seq.Load())
+				} else {
+					err = errConnectionRejected
+				}
+			}
+			if errors.Is(err, errConnectionRejected) || errors.Is(err, errTokenExpired) {
+				app.QueueUpdateDraw(func() {
+					setConnectionStatus("[red]disconnected[-]")
+				})
+				return
+			}
+
+			if err == nil {
+				delay = reconnectMinDelay
+				app.QueueUpdateDraw(func() {
+					// The room may have been left while we were dialing
+					select {
+					case <-stop:
+						conn.Close()
+						return
+					default:
+					}
+					wsConn = conn
+					setConnectionStatus("[green]connected[-]")
+				})
+				readEvents(conn, seq)
+				app.QueueUpdateDraw(func() {
+					if wsConn == conn {
+						wsConn = nil
+					}
+				})
+			}
+
 			select {
-			case <-stopWebsocket:
+			case <-stop:
 				return
 			default:
-				// Read message from WebSocket
-				_, message, err := wsConn.ReadMessage()
-				if err != nil {
-					return
+			}
+			wait := delay
+			app.QueueUpdateDraw(func() {
+				setConnectionStatus(fmt.Sprintf("[yellow]reconnecting in %ds[-]", int(wait.Seconds())))
+			})
+			select {
+			case <-stop:
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, reconnectMaxDelay)
+		}
+	}()
+}
+
+// readEvents handles the frames received on a connection until it fails
+func readEvents(conn *websocket.Conn, seq *atomic.Int64) {
+	defer conn.Close()
+
+	for {
+		// Read message from WebSocket
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// Parse the message
+		var wsMessage wsEvent
+		if err := json.Unmarshal(message, &wsMessage); err != nil {
+			continue
+		}
+
+		// Handle different message types
+		switch wsMessage.Type {
+		case "new_message":
+			// Our own messages arrive here too; receiveMessage skips those
+			// already shown when they were acknowledged
+			noteSeq(seq, wsMessage.Seq)
+			msg := &chatMessage{
+				ID:        wsMessage.ID,
+				SenderID:  wsMessage.Username,
+				Content:   wsMessage.Content,
+				CreatedAt: wsMessage.CreatedAt,
+				Edited:    wsMessage.EditedAt != nil,
+			}
+			if wsMessage.ParentID != nil {
+				msg.ParentID = *wsMessage.ParentID
+			}
+			app.QueueUpdateDraw(func() {
+				setTyping(msg.SenderID, false)
+				receiveMessage(msg)
+			})
+		case "ack":
+			noteSeq(seq, wsMessage.Seq)
+			msg := &chatMessage{
+				ID:        wsMessage.ID,
+				SenderID:  username,
+				Content:   wsMessage.Content,
+				CreatedAt: wsMessage.CreatedAt,
+			}
+			if wsMessage.ParentID != nil {
+				msg.ParentID = *wsMessage.ParentID
+			}
+			app.QueueUpdateDraw(func() {
+				delete(pendingMessages, wsMessage.ClientID)
+				receiveMessage(msg)
+			})
+		case "resync_required":
+			// We missed more than new messages can tell, so reload the room
+			app.QueueUpdateDraw(func() {
+				if wsMessage.RoomID == currentRoomID {
+					fetchMessages(currentRoomID)
+					loadMemberPane(currentRoomID)
+					displayMessage("System", "Reconnected; reloaded the latest messages", time.Now())
 				}
-				
-				// Parse the message
-				var wsMessage struct {
-					Type      string    `json:"type"`
-					ID        string    `json:"id,omitempty"`
-					RoomID    string    `json:"room_id,omitempty"`
-					SenderID  string    `json:"sender_id,omitempty"`
-					Username  string    `json:"username,omitempty"`
-					Content   string    `json:"content,omitempty"`
-					CreatedAt time.Time `json:"created_at,omitempty"`
+			})
+		case "message_edited":
+			noteSeq(seq, wsMessage.Seq)
+			app.QueueUpdateDraw(func() {
+				applyMessageEdit(wsMessage.ID, wsMessage.Content)
+			})
+		case "message_deleted":
+			noteSeq(seq, wsMessage.Seq)
+			app.QueueUpdateDraw(func() {
+				applyMessageDelete(wsMessage.ID)
+			})
+		case "reaction_updated":
+			noteSeq(seq, wsMessage.Seq)
+			app.QueueUpdateDraw(func() {
+				applyReactions(wsMessage.MessageID, wsMessage.Reactions)
+			})
+		case "typing_started", "typing_stopped":
+			app.QueueUpdateDraw(func() {
+				setTyping(wsMessage.Username, wsMessage.Type == "typing_started")
+			})
+		case "mention":
+			app.QueueUpdateDraw(func() {
+				// Mentions in the open room are already highlighted in the timeline
+				if wsMessage.RoomID == currentRoomID {
+					return
 				}
-				
-				if err := json.Unmarshal(message, &wsMessage); err != nil {
-					continue
+				notice := fmt.Sprintf("%s mentioned you in %s: %s", wsMessage.SenderID, wsMessage.RoomName, wsMessage.Content)
+				displayMessage("System", notice, time.Now())
+			})
+		case "presence_changed":
+			app.QueueUpdateDraw(func() {
+				applyPresence(wsMessage)
+			})
+		case "system_message":
+			noteSeq(seq, wsMessage.Seq)
+			app.QueueUpdateDraw(func() {
+				if wsMessage.RoomID == currentRoomID {
+					displayMessage("System", wsMessage.Content, wsMessage.CreatedAt)
 				}
-				
-				// Handle different message types
-				if wsMessage.Type == "new_message" {
-					// Skip displaying messages from ourselves (to avoid duplicates)
-					// since we already show the message when we send it
-					if wsMessage.SenderID != username {
-						app.QueueUpdateDraw(func() {
-							displayMessage(wsMessage.Username, wsMessage.Content, wsMessage.CreatedAt)
-						})
-					}
+			})
+		case "removed_from_room":
+			app.QueueUpdateDraw(func() {
+				leaveRemovedRoom(wsMessage.RoomID, wsMessage.Reason)
+			})
+		case "session_revoked":
+			app.QueueUpdateDraw(endRevokedSession)
+			return
+		case "room_updated":
+			noteSeq(seq, wsMessage.Seq)
+			app.QueueUpdateDraw(func() {
+				applyRoomUpdate(wsMessage)
+			})
+		case "direct_message":
+			app.QueueUpdateDraw(func() {
+				// Messages in the open conversation arrive as new_message
+				if wsMessage.RoomID == currentRoomID {
+					return
 				}
-			}
+				notice := fmt.Sprintf("%s sent you a direct message: %s", wsMessage.SenderID, wsMessage.Content)
+				displayMessage("System", notice, time.Now())
+			})
+		case "error":
+			app.QueueUpdateDraw(func() {
+				delete(pendingMessages, wsMessage.ClientID)
+				showInfoModal("Error", "Failed to send message: "+wsMessage.Error)
+			})
 		}
-	}()
+	}
 }
 
-// sendMessage sends a chat message to the server
-func sendMessage(roomID, content string) {
-	// Prepare request data
-	reqData := map[string]string{
-		"content": content,
-	}
-	jsonData, err := json.Marshal(reqData)
-	if err != nil {
-		showInfoModal("Error", "Failed to prepare message: "+err.Error())
+// sendMessage sends a chat message, or a reply when parentID is set, over the
+// WebSocket, falling back to HTTP
+func sendMessage(roomID, parentID, content string) {
+	if wsConn == nil || roomID != currentRoomID {
+		postMessage(roomID, parentID, content)
 		return
 	}
 
-	// Create HTTP request
-	url := fmt.Sprintf("%s/rooms/%s/messages", apiBaseURL, roomID)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		showInfoModal("Error", "Failed to create request: "+err.Error())
+	// Tag the frame with a client-generated ID so the ack can be matched
+	clientID := uuid.New().String()
+	frame := map[string]string{
+		"type":      "send_message",
+		"client_id": clientID,
+		"parent_id": parentID,
+		"content":   content,
+	}
+	if err := wsConn.WriteJSON(frame); err != nil {
+		postMessage(roomID, parentID, content)
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+authToken)
+	pendingMessages[clientID] = content
+}
+
+// postMessage sends a chat message to the server over HTTP
+func postMessage(roomID, parentID, content string) {
+	// Prepare request data
+	reqData := map[string]string{
+		"content":   content,
+		"parent_id": parentID,
+	}
 
 	// Send request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := apiRequest("POST", "/rooms/"+roomID+"/messages", reqData)
 	if err != nil {
-		showInfoModal("Error", "Connection error: "+err.Error())
+		showInfoModal("Error", "Failed to send message: "+err.Error())
 		return
 	}
 	defer resp.Body.Close()
 
 	// Check response status
 	if resp.StatusCode == http.StatusUnauthorized {
-		showInfoModal("Error", "Unauthorized: Token may be invalid or expired")
+		showInfoModal("Error", errSessionExpired.Error())
 		return
 	} else if resp.StatusCode != http.StatusCreated {
 		showInfoModal("Error", fmt.Sprintf("Failed to send message (status %d)", resp.StatusCode))
@@ -731,101 +925,67 @@ func sendMessage(roomID, content string) {
 	}
 
 	// Display message locally immediately (without waiting for WebSocket)
-	var message struct {
-		ID        string    `json:"id"`
-		RoomID    string    `json:"room_id"`
-		SenderID  string    `json:"sender_id"`
-		Content   string    `json:"content"`
-		CreatedAt time.Time `json:"created_at"`
-	}
+	var message apiMessage
 	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
 		return
 	}
 	
 	// Display our own message immediately
-	displayMessage(username, message.Content, message.CreatedAt)
+	receiveMessage(message.toChatMessage())
 }
 
-// fetchMessages gets all messages for a room
+// fetchMessages gets the latest page of messages for a room
 func fetchMessages(roomID string) {
-	// Create HTTP request
-	req, err := http.NewRequest("GET", apiBaseURL+"/rooms/"+roomID+"/messages", nil)
+	page, err := fetchMessagePage(roomID, "")
 	if err != nil {
 		return
 	}
-	req.Header.Set("Authorization", "Bearer "+authToken)
-
-	// Send request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-
-	// Handle non-200 responses
-	if resp.StatusCode != http.StatusOK {
-		return
-	}
-
-	// Parse the response
-	var messages []struct {
-		ID        string    `json:"id"`
-		RoomID    string    `json:"room_id"`
-		SenderID  string    `json:"sender_id"`
-		Content   string    `json:"content"`
-		CreatedAt time.Time `json:"created_at"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&messages); err != nil {
-		return
-	}
+	olderCursor = page.NextCursor
+	hasOlder = page.HasMore
+	lastSeq.Store(page.LastSeq)
 
 	// Clear previous messages
-	chatDisplay.Clear()
+	chatView.reset()
+	receivedIDs = make(map[string]bool)
 	displayMessage("System", "Welcome to the chat room!", time.Now())
-	displayMessage("System", "Press Ctrl+Q to quit, ESC to go back", time.Now())
+	displayMessage("System", "Press Ctrl+Q to quit, ESC to go back, PgUp to load older messages", time.Now())
 
 	// Display messages
-	for _, msg := range messages {
-		displayMessage(msg.SenderID, msg.Content, msg.CreatedAt)
+	for _, msg := range page.Messages {
+		receivedIDs[msg.ID] = true
+		chatView.add(msg.toChatMessage())
+	}
+
+	// Everything shown now counts as read
+	if receipt, err := fetchReadReceipt(roomID); err == nil {
+		insertUnreadDivider(chatView, receipt)
+	}
+	if len(page.Messages) > 0 {
+		markRead(roomID, page.Messages[len(page.Messages)-1].ID)
 	}
 }
 
-// displayMessage adds a message to the chat display
+// displayMessage adds a message without an ID, such as a system notice, to the chat display
 func displayMessage(senderID, content string, timestamp time.Time) {
-	timeStr := timestamp.Format("15:04:05")
-	
-	var senderName string
-	if senderID == username {
-		senderName = "[green]You[-]"
-	} else if senderID == "System" {
-		senderName = "[blue]System[-]"
-	} else {
-		senderName = "[yellow]" + senderID + "[-]"
-	}
-	
-	msg := fmt.Sprintf("[gray]%s[-] %s: %s\n", timeStr, senderName, content)
-	fmt.Fprint(chatDisplay, msg)
-	
-	// Scroll to end
-	chatDisplay.ScrollToEnd()
+	chatView.add(&chatMessage{
+		SenderID:  senderID,
+		Content:   content,
+		CreatedAt: timestamp,
+	})
 }
 
 // joinRoom sends a request to join an existing room
 func joinRoom(roomCode string) {
-	// Create HTTP request
-	req, err := http.NewRequest("GET", apiBaseURL+"/rooms/code/"+roomCode, nil)
-	if err != nil {
-		showInfoModal("Error", "Failed to create request: "+err.Error())
+	// Invite tokens are accepted in place of a room code
+	if strings.HasPrefix(roomCode, inviteTokenPrefix) {
+		acceptInvite(roomCode)
 		return
 	}
-	req.Header.Set("Authorization", "Bearer "+authToken)
 
 	// Send request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := apiRequest("POST", "/rooms/code/"+roomCode+"/join", nil)
 	if err != nil {
-		showInfoModal("Error", "Connection error: "+err.Error())
+		showInfoModal("Error", "Failed to join room: "+err.Error())
 		return
 	}
 	defer resp.Body.Close()
@@ -835,7 +995,7 @@ func joinRoom(roomCode string) {
 		if resp.StatusCode == http.StatusNotFound {
 			showInfoModal("Error", "Room not found")
 		} else {
-			showInfoModal("Error", fmt.Sprintf("Failed to join room (status %d)", resp.StatusCode))
+			showInfoModal("Error", "Failed to join room: "+apiError(resp).Error())
 		}
 		return
 	}
@@ -0,0 +1,131 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rivo/tview"
+)
+
+const (
+	// reconnectMinDelay is how long we wait before the first reconnect attempt
+	reconnectMinDelay = time.Second
+	// reconnectMaxDelay caps the wait between attempts as it doubles
+	reconnectMaxDelay = 30 * time.Second
+)
+
+var (
+	// errConnectionRejected means the server refused the connection, for
+	// instance because we are no longer a member, so retrying will not help
+	errConnectionRejected = errors.New("connection rejected")
+	// errTokenExpired means the server refused our access token; we can
+	// refresh it and try again
+	errTokenExpired = errors.New("access token expired")
+)
+
+var (
+	connectionStatus *tview.TextView // Connection state, right of the typing indicator
+	lastSeq          *atomic.Int64   // Newest message sequence number seen in the open room
+	receivedIDs      map[string]bool // Messages of the open room already shown
+)
+
+// newConnectionStatus creates the indicator of the room's connection state
+func newConnectionStatus() *tview.TextView {
+	connectionStatus = tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(tview.AlignRight)
+	return connectionStatus
+}
+
+// setConnectionStatus shows the room's connection state
+func setConnectionStatus(text string) {
+	if connectionStatus != nil {
+		connectionStatus.SetText(text)
+	}
+}
+
+// noteSeq records a message sequence number received for the open room
+func noteSeq(seq *atomic.Int64, received int64) {
+	for {
+		current := seq.Load()
+		if received <= current || seq.CompareAndSwap(current, received) {
+			return
+		}
+	}
+}
+
+// alreadyReceived tells whether a message is already shown, and remembers it
+// otherwise. The same message can arrive twice: as an ack and as new_message,
+// or both live and replayed after a reconnect.
+func alreadyReceived(messageID string) bool {
+	if messageID == "" {
+		return false
+	}
+	if receivedIDs[messageID] {
+		return true
+	}
+	receivedIDs[messageID] = true
+	return false
+}
+
+// dialWebSocket opens a WebSocket connection to a room with the given access
+// token, asking the server to replay the messages numbered after afterSeq
+func dialWebSocket(roomID, token string, afterSeq int64) (*websocket.Conn, error) {
+	// Parse the API base URL to create WebSocket URL
+	apiURL, err := url.Parse(apiBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid server URL: %v", errConnectionRejected, err)
+	}
+
+	// Change scheme http -> ws, https -> wss
+	wsScheme := "ws"
+	if apiURL.Scheme == "https" {
+		wsScheme = "wss"
+	}
+
+	wsURL := url.URL{
+		Scheme: wsScheme,
+		Host:   apiURL.Host,
+		Path:   strings.TrimSuffix(apiURL.Path, "/api/v1") + "/api/v1/ws",
+	}
+
+	// Add query parameters for room, auth and where to resume
+	q := wsURL.Query()
+	q.Set("room_id", roomID)
+	q.Set("token", token)
+	q.Set("resume_after", strconv.FormatInt(afterSeq, 10))
+	wsURL.RawQuery = q.Encode()
+
+	header := http.Header{}
+	header.Add("Authorization", "Bearer "+token)
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL.String(), header)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return nil, errTokenExpired
+		}
+		if resp != nil && resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w (status %d)", errConnectionRejected, resp.StatusCode)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// closeWebSocket closes the room's connection and stops reconnecting
+func closeWebSocket() {
+	if stopWebsocket != nil {
+		close(stopWebsocket)
+		stopWebsocket = nil
+	}
+	if wsConn != nil {
+		wsConn.Close()
+		wsConn = nil
+	}
+}
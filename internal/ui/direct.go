@@ -0,0 +1,109 @@
+package ui
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"github.com/rivo/tview"
+)
+
+// showDirectMessagesPage lists our direct conversations, most recently active first
+func showDirectMessagesPage() {
+	var conversations []roomSummary
+	if err := apiCall("GET", "/dm", nil, &conversations); err != nil {
+		showInfoModal("Error", "Failed to load direct messages: "+err.Error())
+		return
+	}
+
+	// Unread counts are only decoration, so the list is still shown without them
+	unread := make(map[string]int)
+	if counts, err := fetchUnreadCounts(); err == nil {
+		for _, count := range counts {
+			unread[count.RoomID] = count.UnreadCount
+		}
+	}
+
+	list := tview.NewList().ShowSecondaryText(true)
+	list.SetBorder(true).
+		SetTitle(" Direct Messages ").
+		SetTitleAlign(tview.AlignCenter)
+
+	list.AddItem("New Message", "Start a conversation by username", 'n', showNewDirectMessageModal)
+	for _, conversation := range conversations {
+		peer := ""
+		if conversation.Peer != nil {
+			peer = *conversation.Peer
+		}
+
+		mainText := "@ " + tview.Escape(peer)
+		if count := unread[conversation.ID]; count > 0 {
+			mainText += fmt.Sprintf(" [black:yellow] %d [-:-]", count)
+		}
+		secondary := "No messages yet"
+		if conversation.LastMessage != nil && conversation.LastMessageSender != nil && conversation.LastMessageAt != nil {
+			secondary = fmt.Sprintf("%s  %s: %s", formatRoomActivity(*conversation.LastMessageAt),
+				tview.Escape(*conversation.LastMessageSender), tview.Escape(*conversation.LastMessage))
+		}
+
+		room := &models.Room{ID: conversation.ID, Name: conversation.Name, Code: conversation.Code, Kind: conversation.Kind}
+		list.AddItem(mainText, secondary, 0, func() {
+			pages.RemovePage("directs")
+			openDirectConversation(room, peer)
+		})
+	}
+
+	pages.AddPage("directs", list, true, false)
+	pages.SwitchToPage("directs")
+}
+
+// closeDirectMessages leaves the direct messages page for the rooms page
+func closeDirectMessages() {
+	pages.RemovePage("directs")
+	showRoomsPage()
+}
+
+// showNewDirectMessageModal asks for a username and a first message
+func showNewDirectMessageModal() {
+	form := tview.NewForm()
+	form.AddInputField("To", "", 30, nil, nil)
+	form.AddInputField("Message", "", 30, nil, nil)
+	form.AddButton("Send", func() {
+		peer := strings.TrimPrefix(strings.TrimSpace(form.GetFormItem(0).(*tview.InputField).GetText()), "@")
+		content := form.GetFormItem(1).(*tview.InputField).GetText()
+		if peer == "" || content == "" {
+			showInfoModal("Error", "Enter a username and a message")
+			return
+		}
+
+		var message apiMessage
+		if err := apiCall("POST", "/dm/"+url.PathEscape(peer)+"/messages", map[string]string{"content": content}, &message); err != nil {
+			showInfoModal("Error", "Failed to send message: "+err.Error())
+			return
+		}
+
+		pages.RemovePage("directMessageModal")
+		pages.RemovePage("directs")
+		openDirectConversation(&models.Room{ID: message.RoomID, Name: "Direct message", Kind: models.RoomKindDirect}, peer)
+	})
+	form.AddButton("Cancel", func() {
+		pages.RemovePage("directMessageModal")
+	})
+
+	form.SetBorder(true).
+		SetTitle(" New Direct Message ").
+		SetTitleAlign(tview.AlignCenter)
+
+	pages.AddPage("directMessageModal", tview.NewGrid().
+		SetColumns(0, 46, 0).
+		SetRows(0, 9, 0).
+		AddItem(form, 1, 1, 1, 1, 0, 0, true), true, true)
+}
+
+// openDirectConversation opens the chat screen for a direct conversation
+func openDirectConversation(room *models.Room, peer string) {
+	setupChatRoom(room)
+	chatDisplay.SetTitle(" Direct message with " + tview.Escape(peer) + " ")
+	pages.SwitchToPage("chat")
+}
@@ -0,0 +1,103 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// historyPageSize is the number of messages loaded per page of history
+const historyPageSize = 50
+
+var (
+	olderCursor  string // Cursor of the page before the oldest loaded message
+	hasOlder     bool   // Whether the room has messages older than the loaded ones
+	loadingOlder bool   // Guards against loading the same page twice
+)
+
+// messagePage is a page of a room's history as returned by the API
+type messagePage struct {
+	Messages    []apiMessage `json:"messages"`
+	NextCursor  string       `json:"next_cursor"`
+	NewerCursor string       `json:"newer_cursor"`
+	HasMore     bool         `json:"has_more"`
+	LastSeq     int64        `json:"last_seq"`
+}
+
+// fetchMessagePage gets the page of top-level messages before the cursor, or
+// the latest page when the cursor is empty
+func fetchMessagePage(roomID, before string) (*messagePage, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(historyPageSize))
+	if before != "" {
+		query.Set("before", before)
+	}
+	return fetchHistory(roomID, query)
+}
+
+// fetchMessagesAround gets the page of top-level messages centered on a
+// message, or on the message it replies to
+func fetchMessagesAround(roomID, messageID string) (*messagePage, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(historyPageSize))
+	query.Set("around", messageID)
+	return fetchHistory(roomID, query)
+}
+
+// fetchHistory gets a page of a room's history selected by query
+func fetchHistory(roomID string, query url.Values) (*messagePage, error) {
+	resp, err := apiRequest("GET", fmt.Sprintf("/rooms/%s/messages?%s", roomID, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var page messagePage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return &page, nil
+}
+
+// loadOlderMessages prepends the previous page of history to the chat view
+func loadOlderMessages() {
+	if !hasOlder || loadingOlder {
+		return
+	}
+	loadingOlder = true
+	roomID, cursor := currentRoomID, olderCursor
+
+	// Fetch in the background so scrolling stays responsive
+	go func() {
+		page, err := fetchMessagePage(roomID, cursor)
+		app.QueueUpdateDraw(func() {
+			loadingOlder = false
+			if roomID != currentRoomID {
+				return
+			}
+			if err != nil {
+				showInfoModal("Error", "Failed to load older messages: "+err.Error())
+				return
+			}
+
+			olderCursor = page.NextCursor
+			hasOlder = page.HasMore
+			chatView.prepend(page.chatMessages())
+		})
+	}()
+}
+
+// chatMessages converts the messages of a page for display
+func (page *messagePage) chatMessages() []*chatMessage {
+	messages := make([]*chatMessage, len(page.Messages))
+	for i, msg := range page.Messages {
+		messages[i] = msg.toChatMessage()
+	}
+	return messages
+}
@@ -0,0 +1,177 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+)
+
+// inviteTokenPrefix tells invite tokens apart from room codes
+const inviteTokenPrefix = "inv_"
+
+// roomInvite is an invite to a room, as returned by the API
+type roomInvite struct {
+	ID        string    `json:"id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxUses   int       `json:"max_uses"`
+	Uses      int       `json:"uses"`
+}
+
+// acceptInvite joins the room an invite token belongs to
+func acceptInvite(token string) {
+	resp, err := apiRequest("POST", "/invites/"+url.PathEscape(token)+"/accept", nil)
+	if err != nil {
+		showInfoModal("Error", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		showInfoModal("Error", "Failed to accept invite: "+apiError(resp).Error())
+		return
+	}
+
+	var room models.Room
+	if err := json.NewDecoder(resp.Body).Decode(&room); err != nil {
+		showInfoModal("Error", "Failed to parse response: "+err.Error())
+		return
+	}
+
+	setupChatRoom(&room)
+	pages.SwitchToPage("chat")
+}
+
+// handleInviteCommand runs the room administration commands: /invite [hours]
+// [uses], /invites, /revoke <id>, /rotate and /private on|off
+func handleInviteCommand(command, args string) {
+	switch command {
+	case "invite":
+		fields := strings.Fields(args)
+		hours, uses := 24, 0
+		var err error
+		if len(fields) > 0 {
+			if hours, err = strconv.Atoi(fields[0]); err != nil || hours <= 0 {
+				showInfoModal("Error", "Usage: /invite [hours] [max uses]")
+				return
+			}
+		}
+		if len(fields) > 1 {
+			if uses, err = strconv.Atoi(fields[1]); err != nil || uses < 0 {
+				showInfoModal("Error", "Usage: /invite [hours] [max uses]")
+				return
+			}
+		}
+		invite, err := createInvite(currentRoomID, time.Duration(hours)*time.Hour, uses)
+		if err != nil {
+			showInfoModal("Error", "Failed to create invite: "+err.Error())
+			return
+		}
+		displayMessage("System", "Invite: "+invite.Token+" ("+describeInvite(invite)+"). Paste it into Join Room.", time.Now())
+	case "invites":
+		invites, err := fetchInvites(currentRoomID)
+		if err != nil {
+			showInfoModal("Error", "Failed to load invites: "+err.Error())
+			return
+		}
+		if len(invites) == 0 {
+			displayMessage("System", "This room has no active invites", time.Now())
+			return
+		}
+		for _, invite := range invites {
+			displayMessage("System", fmt.Sprintf("%s  %s (%s)", invite.ID[:8], invite.Token, describeInvite(&invite)), time.Now())
+		}
+	case "revoke":
+		if args == "" {
+			showInfoModal("Error", "Usage: /revoke <invite id>, as listed by /invites")
+			return
+		}
+		invites, err := fetchInvites(currentRoomID)
+		if err != nil {
+			showInfoModal("Error", "Failed to load invites: "+err.Error())
+			return
+		}
+		var match *roomInvite
+		for i := range invites {
+			if strings.HasPrefix(invites[i].ID, args) || invites[i].Token == args {
+				match = &invites[i]
+				break
+			}
+		}
+		if match == nil {
+			showInfoModal("Error", "No active invite matches "+args)
+			return
+		}
+		if err := revokeInvite(currentRoomID, match.ID); err != nil {
+			showInfoModal("Error", "Failed to revoke invite: "+err.Error())
+			return
+		}
+		displayMessage("System", "Invite "+match.ID[:8]+" revoked", time.Now())
+	case "rotate":
+		var room models.Room
+		if err := apiCall("POST", "/rooms/"+currentRoomID+"/code", nil, &room); err != nil {
+			showInfoModal("Error", "Failed to rotate room code: "+err.Error())
+			return
+		}
+		currentRoomCode = room.Code
+		refreshRoomTitle()
+		displayMessage("System", "New room code: "+room.Code+". The old code no longer works.", time.Now())
+	case "private":
+		if args != "on" && args != "off" {
+			showInfoModal("Error", "Usage: /private on|off")
+			return
+		}
+		var room models.Room
+		if err := apiCall("PUT", "/rooms/"+currentRoomID+"/private", map[string]bool{"private": args == "on"}, &room); err != nil {
+			showInfoModal("Error", "Failed to update room: "+err.Error())
+			return
+		}
+		if room.Private {
+			displayMessage("System", "The room is now private; joining needs an invite", time.Now())
+		} else {
+			displayMessage("System", "The room is now open to anyone with its code", time.Now())
+		}
+	}
+}
+
+// describeInvite summarizes an invite's expiry and remaining uses
+func describeInvite(invite *roomInvite) string {
+	expiry := "expires " + invite.ExpiresAt.Local().Format("2006-01-02 15:04")
+	if invite.MaxUses == 0 {
+		return expiry + ", unlimited uses"
+	}
+	return fmt.Sprintf("%s, %d of %d uses left", expiry, invite.MaxUses-invite.Uses, invite.MaxUses)
+}
+
+// createInvite creates an invite to a room
+func createInvite(roomID string, ttl time.Duration, maxUses int) (*roomInvite, error) {
+	var invite roomInvite
+	body := map[string]int{
+		"expires_in": int(ttl.Seconds()),
+		"max_uses":   maxUses,
+	}
+	if err := apiCall("POST", "/rooms/"+roomID+"/invites", body, &invite); err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// fetchInvites retrieves the active invites of a room
+func fetchInvites(roomID string) ([]roomInvite, error) {
+	var invites []roomInvite
+	if err := apiCall("GET", "/rooms/"+roomID+"/invites", nil, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// revokeInvite stops an invite from being used
+func revokeInvite(roomID, inviteID string) error {
+	return apiCall("DELETE", "/rooms/"+roomID+"/invites/"+inviteID, nil, nil)
+}
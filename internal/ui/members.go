@@ -0,0 +1,76 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// roomMember is a member of a room, as returned by the API
+type roomMember struct {
+	UserID     string     `json:"user_id"`
+	Role       string     `json:"role"`
+	MutedUntil *time.Time `json:"muted_until"`
+	Status     string     `json:"status"`
+	LastSeen   *time.Time `json:"last_seen"`
+}
+
+// showMembers lists the members of the current room with their roles
+func showMembers() {
+	members, err := fetchMembers(currentRoomID)
+	if err != nil {
+		showInfoModal("Error", "Failed to load members: "+err.Error())
+		return
+	}
+
+	names := make([]string, len(members))
+	for i, member := range members {
+		names[i] = member.UserID
+		if member.Role != "member" {
+			names[i] += " (" + member.Role + ")"
+		}
+		if member.MutedUntil != nil && time.Now().Before(*member.MutedUntil) {
+			names[i] += " (muted)"
+		}
+		if member.Status != "" && member.Status != "offline" {
+			names[i] += " (" + member.Status + ")"
+		}
+	}
+	displayMessage("System", fmt.Sprintf("%d members: %s", len(members), strings.Join(names, ", ")), time.Now())
+}
+
+// fetchMembers retrieves the members of a room
+func fetchMembers(roomID string) ([]roomMember, error) {
+	resp, err := apiRequest("GET", "/rooms/"+roomID+"/members", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var members []roomMember
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return members, nil
+}
+
+// setMemberRole makes a member of a room an admin or a plain member
+func setMemberRole(roomID, member, role string) error {
+	resp, err := apiRequest("PUT", "/rooms/"+roomID+"/members/"+url.PathEscape(member), map[string]string{"role": role})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// mentionItem is an entry of the mentions inbox, as returned by the API
+type mentionItem struct {
+	ID          string    `json:"id"`
+	MessageID   string    `json:"message_id"`
+	RoomID      string    `json:"room_id"`
+	MentionedBy string    `json:"mentioned_by"`
+	ParentID    *string   `json:"parent_id"`
+	Content     string    `json:"content"`
+	RoomName    string    `json:"room_name"`
+	RoomCode    string    `json:"room_code"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// showMentionsPage lists the messages that mentioned us; selecting one jumps to it
+func showMentionsPage() {
+	mentions, err := fetchMentions()
+	if err != nil {
+		showInfoModal("Error", "Failed to load mentions: "+err.Error())
+		return
+	}
+
+	list := tview.NewList().ShowSecondaryText(true)
+	list.SetBorder(true).
+		SetTitle(" Mentions ").
+		SetTitleAlign(tview.AlignCenter)
+
+	if len(mentions) == 0 {
+		list.AddItem("Nobody has mentioned you yet", "", 0, nil)
+	}
+	for _, mention := range mentions {
+		mainText := fmt.Sprintf("[%s] %s: %s", tview.Escape(mention.RoomName), tview.Escape(mention.MentionedBy), highlightMentions(tview.Escape(mention.Content)))
+		secondary := mention.CreatedAt.Local().Format("2006-01-02 15:04:05")
+		list.AddItem(mainText, secondary, 0, func() {
+			pages.RemovePage("mentions")
+			jumpToMessage(mention.RoomID, mention.RoomCode, mention.MessageID, mention.ParentID)
+		})
+	}
+
+	pages.AddPage("mentions", list, true, false)
+	pages.SwitchToPage("mentions")
+}
+
+// closeMentions leaves the mentions page for the rooms page
+func closeMentions() {
+	pages.RemovePage("mentions")
+	showRoomsPage()
+}
+
+// fetchMentions retrieves our latest mentions, newest first
+func fetchMentions() ([]mentionItem, error) {
+	resp, err := apiRequest("GET", "/mentions", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var mentions []mentionItem
+	if err := json.NewDecoder(resp.Body).Decode(&mentions); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return mentions, nil
+}
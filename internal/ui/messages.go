@@ -0,0 +1,570 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// apiMessage is a message as returned by the API
+type apiMessage struct {
+	ID         string                 `json:"id"`
+	RoomID     string                 `json:"room_id"`
+	SenderID   string                 `json:"sender_id"`
+	ParentID   *string                `json:"parent_id"`
+	Content    string                 `json:"content"`
+	ReplyCount int                    `json:"reply_count"`
+	Reactions  []models.ReactionCount `json:"reactions"`
+	EditedAt   *time.Time             `json:"edited_at"`
+	DeletedAt  *time.Time             `json:"deleted_at"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// toChatMessage converts an API message for display
+func (m apiMessage) toChatMessage() *chatMessage {
+	msg := &chatMessage{
+		ID:         m.ID,
+		SenderID:   m.SenderID,
+		Content:    m.Content,
+		CreatedAt:  m.CreatedAt,
+		Edited:     m.EditedAt != nil,
+		Deleted:    m.DeletedAt != nil,
+		ReplyCount: m.ReplyCount,
+		Reactions:  m.Reactions,
+	}
+	if m.ParentID != nil {
+		msg.ParentID = *m.ParentID
+	}
+	return msg
+}
+
+// chatMessage is a message shown in the chat display
+type chatMessage struct {
+	ID         string
+	SenderID   string
+	ParentID   string
+	Content    string
+	CreatedAt  time.Time
+	Edited     bool
+	Deleted    bool
+	ReplyCount int
+	Reactions  []models.ReactionCount
+	Divider    bool // Marks where unread messages start rather than a message
+}
+
+// messageView is a text view listing messages that can be selected and re-rendered
+type messageView struct {
+	display    *tview.TextView
+	messages   []*chatMessage // Messages currently shown, oldest first
+	selectedID string         // Message highlighted with the arrow keys
+	onTop      func()         // Called when the user scrolls past the oldest message
+}
+
+var (
+	chatView   *messageView // Main room timeline
+	threadView *messageView // Replies of the open thread, nil when no thread is open
+)
+
+// mentionPattern matches @username mentions the same way the server parses them
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.\-]+)`)
+
+// newMessageView wraps a text view that displays messages
+func newMessageView(display *tview.TextView) *messageView {
+	display.SetDynamicColors(true).SetRegions(true)
+	return &messageView{display: display}
+}
+
+// reset clears the view and the messages behind it
+func (v *messageView) reset() {
+	v.messages = nil
+	v.selectedID = ""
+	v.display.Clear()
+}
+
+// add appends a message to the view
+func (v *messageView) add(msg *chatMessage) {
+	v.messages = append(v.messages, msg)
+	fmt.Fprint(v.display, formatMessage(msg))
+
+	// Scroll to end
+	v.display.ScrollToEnd()
+}
+
+// prepend inserts older messages above the loaded ones, after any leading
+// system notices, keeping the current scroll position
+func (v *messageView) prepend(older []*chatMessage) {
+	head := 0
+	for head < len(v.messages) && v.messages[head].ID == "" && !v.messages[head].Divider {
+		head++
+	}
+
+	merged := make([]*chatMessage, 0, len(v.messages)+len(older))
+	merged = append(merged, v.messages[:head]...)
+	merged = append(merged, older...)
+	merged = append(merged, v.messages[head:]...)
+	v.messages = merged
+
+	row, col := v.display.GetScrollOffset()
+	before := v.display.GetWrappedLineCount()
+	v.render()
+	v.display.ScrollTo(row+v.display.GetWrappedLineCount()-before, col)
+}
+
+// find returns the displayed message with the given ID
+func (v *messageView) find(messageID string) *chatMessage {
+	for _, msg := range v.messages {
+		if msg.ID != "" && msg.ID == messageID {
+			return msg
+		}
+	}
+	return nil
+}
+
+// render redraws the whole view after a message changed
+func (v *messageView) render() {
+	row, col := v.display.GetScrollOffset()
+	v.display.Clear()
+	for _, msg := range v.messages {
+		fmt.Fprint(v.display, formatMessage(msg))
+	}
+	v.display.ScrollTo(row, col)
+}
+
+// moveSelection highlights the previous (delta < 0) or next (delta > 0) message
+func (v *messageView) moveSelection(delta int) {
+	var selectable []*chatMessage
+	for _, msg := range v.messages {
+		if msg.ID != "" {
+			selectable = append(selectable, msg)
+		}
+	}
+	if len(selectable) == 0 {
+		return
+	}
+
+	index := len(selectable)
+	for i, msg := range selectable {
+		if msg.ID == v.selectedID {
+			index = i
+			break
+		}
+	}
+
+	index += delta
+	if index < 0 {
+		index = 0
+		if v.onTop != nil {
+			v.onTop()
+		}
+	}
+	if index >= len(selectable) {
+		// Moving past the newest message clears the selection
+		v.clearSelection()
+		return
+	}
+
+	v.selectedID = selectable[index].ID
+	v.display.Highlight(v.selectedID).ScrollToHighlight()
+}
+
+// pageUp scrolls up one screen, asking for older messages at the top
+func (v *messageView) pageUp() {
+	row, col := v.display.GetScrollOffset()
+	if row == 0 {
+		if v.onTop != nil {
+			v.onTop()
+		}
+		return
+	}
+
+	_, _, _, height := v.display.GetInnerRect()
+	v.display.ScrollTo(max(row-height, 0), col)
+}
+
+// pageDown scrolls down one screen, following new messages again at the end
+func (v *messageView) pageDown() {
+	row, col := v.display.GetScrollOffset()
+	_, _, _, height := v.display.GetInnerRect()
+	if row+2*height >= v.display.GetWrappedLineCount() {
+		v.display.ScrollToEnd()
+		return
+	}
+	v.display.ScrollTo(row+height, col)
+}
+
+// selectMessage highlights a message and scrolls it into view
+func (v *messageView) selectMessage(messageID string) {
+	if v.find(messageID) == nil {
+		return
+	}
+	v.selectedID = messageID
+	v.display.Highlight(messageID).ScrollToHighlight()
+}
+
+// clearSelection removes the message highlight
+func (v *messageView) clearSelection() {
+	v.selectedID = ""
+	v.display.Highlight()
+	v.display.ScrollToEnd()
+}
+
+// selected returns the highlighted message, if any
+func (v *messageView) selected() *chatMessage {
+	return v.find(v.selectedID)
+}
+
+// target returns the selected message, otherwise the latest message
+func (v *messageView) target() *chatMessage {
+	if msg := v.selected(); msg != nil {
+		return msg
+	}
+	for i := len(v.messages) - 1; i >= 0; i-- {
+		if v.messages[i].ID != "" {
+			return v.messages[i]
+		}
+	}
+	return nil
+}
+
+// ownTarget returns the selected message if it is ours, otherwise our latest message
+func (v *messageView) ownTarget() *chatMessage {
+	if msg := v.selected(); msg != nil && msg.SenderID == username {
+		return msg
+	}
+	for i := len(v.messages) - 1; i >= 0; i-- {
+		if v.messages[i].ID != "" && v.messages[i].SenderID == username {
+			return v.messages[i]
+		}
+	}
+	return nil
+}
+
+// selectionKeys lets Up/Down in an input field move the selection of a view
+// and PgUp/PgDn scroll it
+func selectionKeys(view func() *messageView) func(event *tcell.EventKey) *tcell.EventKey {
+	return func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyUp:
+			view().moveSelection(-1)
+			return nil
+		case tcell.KeyDown:
+			view().moveSelection(1)
+			return nil
+		case tcell.KeyPgUp:
+			view().pageUp()
+			return nil
+		case tcell.KeyPgDn:
+			view().pageDown()
+			return nil
+		}
+		return event
+	}
+}
+
+// scrollTopMouse asks a view for older messages when the mouse wheel scrolls past its top
+func scrollTopMouse(view func() *messageView) func(action tview.MouseAction, event *tcell.EventMouse) (tview.MouseAction, *tcell.EventMouse) {
+	return func(action tview.MouseAction, event *tcell.EventMouse) (tview.MouseAction, *tcell.EventMouse) {
+		if action == tview.MouseScrollUp {
+			if row, _ := view().display.GetScrollOffset(); row == 0 && view().onTop != nil {
+				view().onTop()
+			}
+		}
+		return action, event
+	}
+}
+
+// formatMessage renders a single message line, wrapped in a region so it can be highlighted
+func formatMessage(msg *chatMessage) string {
+	if msg.Divider {
+		return "[red]──────── new messages ────────[-]\n"
+	}
+
+	timeStr := msg.CreatedAt.Format("15:04:05")
+
+	var senderName string
+	if msg.SenderID == username {
+		senderName = "[green]You[-]"
+	} else if msg.SenderID == "System" {
+		senderName = "[blue]System[-]"
+	} else {
+		senderName = "[yellow]" + tview.Escape(msg.SenderID) + "[-]"
+	}
+
+	var line string
+	if msg.Deleted {
+		line = fmt.Sprintf("[gray]%s[-] %s: [gray::i]message deleted[-::-]", timeStr, senderName)
+	} else {
+		line = fmt.Sprintf("[gray]%s[-] %s: %s", timeStr, senderName, highlightMentions(tview.Escape(msg.Content)))
+		if msg.Edited {
+			line += " [gray](edited)[-]"
+		}
+	}
+	if msg.ReplyCount == 1 {
+		line += " [blue](1 reply)[-]"
+	} else if msg.ReplyCount > 1 {
+		line += fmt.Sprintf(" [blue](%d replies)[-]", msg.ReplyCount)
+	}
+
+	if len(msg.Reactions) > 0 && !msg.Deleted {
+		line += "\n         " + formatReactions(msg.Reactions)
+	}
+
+	if msg.ID == "" {
+		return line + "\n"
+	}
+	return fmt.Sprintf("[\"%s\"]%s[\"\"]\n", msg.ID, line)
+}
+
+// highlightMentions colors @username mentions, making our own stand out
+func highlightMentions(content string) string {
+	return mentionPattern.ReplaceAllStringFunc(content, func(match string) string {
+		at := strings.Index(match, "@")
+		name := strings.TrimRight(match[at+1:], ".-")
+		rest := match[at+1+len(name):]
+		if name == "" {
+			return match
+		}
+		if name == username {
+			return match[:at] + "[black:yellow]@" + name + "[-:-]" + rest
+		}
+		return match[:at] + "[aqua]@" + name + "[-]" + rest
+	})
+}
+
+// formatReactions renders reaction counts, highlighting the ones we added
+func formatReactions(reactions []models.ReactionCount) string {
+	parts := make([]string, 0, len(reactions))
+	for _, reaction := range reactions {
+		color := "gray"
+		for _, user := range reaction.Users {
+			if user == username {
+				color = "green"
+				break
+			}
+		}
+		parts = append(parts, fmt.Sprintf("[%s]:%s: %d[-]", color, reaction.Emoji, reaction.Count))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// receiveMessage shows a new message in the main timeline, or in its thread
+// when it is a reply
+func receiveMessage(msg *chatMessage) {
+	if alreadyReceived(msg.ID) {
+		return
+	}
+
+	// Messages arriving while the room is on screen are read right away
+	if name, _ := pages.GetFrontPage(); name == "chat" || name == "thread" {
+		markRead(currentRoomID, msg.ID)
+	}
+
+	if msg.ParentID == "" {
+		chatView.add(msg)
+		return
+	}
+
+	if threadView != nil && threadParentID == msg.ParentID && threadView.find(msg.ID) == nil {
+		threadView.add(msg)
+	}
+	eachView(func(view *messageView) {
+		if parent := view.find(msg.ParentID); parent != nil {
+			parent.ReplyCount++
+			view.render()
+		}
+	})
+}
+
+// eachView calls fn for every open message view
+func eachView(fn func(view *messageView)) {
+	fn(chatView)
+	if threadView != nil {
+		fn(threadView)
+	}
+}
+
+// handleCommand runs a slash command typed into the input of a message view
+func handleCommand(view *messageView, input string) {
+	command, args, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+	args = strings.TrimSpace(args)
+
+	switch command {
+	case "edit":
+		if args == "" {
+			showInfoModal("Error", "Usage: /edit <new text>")
+			return
+		}
+		msg := view.ownTarget()
+		if msg == nil {
+			showInfoModal("Error", "You have no message to edit")
+			return
+		}
+		if err := editMessage(currentRoomID, msg.ID, args); err != nil {
+			showInfoModal("Error", "Failed to edit message: "+err.Error())
+			return
+		}
+		applyMessageEdit(msg.ID, args)
+	case "delete":
+		// Moderators may delete other people's messages once selected
+		msg := view.selected()
+		if msg == nil {
+			msg = view.ownTarget()
+		}
+		if msg == nil || msg.Deleted {
+			showInfoModal("Error", "You have no message to delete")
+			return
+		}
+		if err := deleteMessage(currentRoomID, msg.ID); err != nil {
+			showInfoModal("Error", "Failed to delete message: "+err.Error())
+			return
+		}
+		applyMessageDelete(msg.ID)
+	case "react", "unreact":
+		if args == "" {
+			showInfoModal("Error", "Usage: /"+command+" <emoji>, for example /"+command+" :thumbsup:")
+			return
+		}
+		msg := view.target()
+		if msg == nil || msg.Deleted {
+			showInfoModal("Error", "There is no message to react to")
+			return
+		}
+		reactions, err := updateReaction(currentRoomID, msg.ID, args, command == "react")
+		if err != nil {
+			showInfoModal("Error", "Failed to update reaction: "+err.Error())
+			return
+		}
+		applyReactions(msg.ID, reactions)
+	case "thread":
+		msg := view.selected()
+		if msg == nil {
+			showInfoModal("Error", "Select a message with Up/Down to open its thread")
+			return
+		}
+		openThread(msg)
+	case "search":
+		showSearchPage(args)
+	case "members":
+		showMembers()
+	case "invite", "invites", "revoke", "rotate", "private":
+		handleInviteCommand(command, args)
+	case "rename", "topic", "archive", "unarchive":
+		handleRoomCommand(command, args)
+	case "kick", "ban", "unban", "bans", "mute", "unmute":
+		handleModerationCommand(command, args)
+	case "promote", "demote":
+		member := strings.TrimPrefix(args, "@")
+		if member == "" {
+			showInfoModal("Error", "Usage: /"+command+" <username>")
+			return
+		}
+		role := "admin"
+		if command == "demote" {
+			role = "member"
+		}
+		if err := setMemberRole(currentRoomID, member, role); err != nil {
+			showInfoModal("Error", "Failed to change role: "+err.Error())
+			return
+		}
+		displayMessage("System", member+" is now a room "+role, time.Now())
+	case "help":
+		displayMessage("System", "Commands: /edit <text> edits and /delete deletes the selected or your last message, /react <emoji> and /unreact <emoji> react to the selected or latest message, /thread opens the selected message's thread, /search [query] searches messages, /members lists the room's members, /promote and /demote <user> change a member's role. Room owners and admins can also use /invite [hours] [uses], /invites, /revoke <id>, /rotate, /private on|off, /rename <name>, /topic [text], /archive, /unarchive, /kick <user>, /ban <user>, /unban <user>, /bans, /mute <user> [minutes] and /unmute <user>. Use Up/Down to select a message.", time.Now())
+	default:
+		showInfoModal("Error", "Unknown command: /"+command)
+	}
+}
+
+// applyMessageEdit updates a displayed message after a message_edited event
+func applyMessageEdit(messageID, content string) {
+	eachView(func(view *messageView) {
+		if msg := view.find(messageID); msg != nil {
+			msg.Content = content
+			msg.Edited = true
+			view.render()
+		}
+	})
+}
+
+// applyMessageDelete replaces a displayed message with a tombstone after a message_deleted event
+func applyMessageDelete(messageID string) {
+	eachView(func(view *messageView) {
+		if msg := view.find(messageID); msg != nil {
+			msg.Content = ""
+			msg.Deleted = true
+			view.render()
+		}
+	})
+}
+
+// applyReactions updates the reaction counts of a displayed message after a reaction_updated event
+func applyReactions(messageID string, reactions []models.ReactionCount) {
+	eachView(func(view *messageView) {
+		if msg := view.find(messageID); msg != nil {
+			msg.Reactions = reactions
+			view.render()
+		}
+	})
+}
+
+// editMessage sends a request to change the content of one of our messages
+func editMessage(roomID, messageID, content string) error {
+	resp, err := apiRequest("PATCH", fmt.Sprintf("/rooms/%s/messages/%s", roomID, messageID), map[string]string{
+		"content": content,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp)
+	}
+	return nil
+}
+
+// deleteMessage sends a request to delete a message
+func deleteMessage(roomID, messageID string) error {
+	resp, err := apiRequest("DELETE", fmt.Sprintf("/rooms/%s/messages/%s", roomID, messageID), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return apiError(resp)
+	}
+	return nil
+}
+
+// updateReaction adds or removes our reaction to a message and returns the new counts
+func updateReaction(roomID, messageID, emoji string, add bool) ([]models.ReactionCount, error) {
+	method := "PUT"
+	if !add {
+		method = "DELETE"
+	}
+
+	path := fmt.Sprintf("/rooms/%s/messages/%s/reactions/%s", roomID, messageID, url.PathEscape(strings.Trim(emoji, ":")))
+	resp, err := apiRequest(method, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var reactions []models.ReactionCount
+	if err := json.NewDecoder(resp.Body).Decode(&reactions); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return reactions, nil
+}
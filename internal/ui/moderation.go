@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// roomBan is a user banned from a room, as returned by the API
+type roomBan struct {
+	UserID    string    `json:"user_id"`
+	BannedBy  string    `json:"banned_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handleModerationCommand runs the commands room owners and admins use to
+// keep order: /kick, /ban, /unban and /unmute <user>, /mute <user>
+// [minutes] and /bans
+func handleModerationCommand(command, args string) {
+	if command == "bans" {
+		var bans []roomBan
+		if err := apiCall("GET", "/rooms/"+currentRoomID+"/bans", nil, &bans); err != nil {
+			showInfoModal("Error", "Failed to load bans: "+err.Error())
+			return
+		}
+		if len(bans) == 0 {
+			displayMessage("System", "Nobody is banned from this room", time.Now())
+			return
+		}
+		for _, ban := range bans {
+			displayMessage("System", fmt.Sprintf("%s banned by %s on %s", ban.UserID, ban.BannedBy, ban.CreatedAt.Local().Format("2006-01-02 15:04")), time.Now())
+		}
+		return
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 || (command != "mute" && len(fields) > 1) {
+		if command == "mute" {
+			showInfoModal("Error", "Usage: /mute <username> [minutes]")
+		} else {
+			showInfoModal("Error", "Usage: /"+command+" <username>")
+		}
+		return
+	}
+	member := url.PathEscape(strings.TrimPrefix(fields[0], "@"))
+	path := "/rooms/" + currentRoomID
+
+	var err error
+	switch command {
+	case "kick":
+		err = apiCall("DELETE", path+"/members/"+member, nil, nil)
+	case "ban":
+		err = apiCall("PUT", path+"/bans/"+member, nil, nil)
+	case "unban":
+		if err = apiCall("DELETE", path+"/bans/"+member, nil, nil); err == nil {
+			displayMessage("System", fields[0]+" can join the room again", time.Now())
+		}
+	case "mute":
+		minutes := 10
+		if len(fields) > 1 {
+			if minutes, err = strconv.Atoi(fields[1]); err != nil || minutes <= 0 {
+				showInfoModal("Error", "Usage: /mute <username> [minutes]")
+				return
+			}
+		}
+		err = apiCall("PUT", path+"/members/"+member+"/mute", map[string]int{"duration": minutes * 60}, nil)
+	case "unmute":
+		err = apiCall("DELETE", path+"/members/"+member+"/mute", nil, nil)
+	}
+	// Successful actions are announced to the room by the server
+	if err != nil {
+		showInfoModal("Error", "Failed to /"+command+" "+fields[0]+": "+err.Error())
+	}
+}
+
+// leaveRemovedRoom returns to the rooms page after we were kicked or banned
+// from the open room
+func leaveRemovedRoom(roomID, reason string) {
+	if roomID != currentRoomID {
+		return
+	}
+	currentRoomID = ""
+	closeWebSocket()
+	pages.RemovePage("thread")
+	showRoomsPage()
+	showInfoModal("Removed", "You were "+reason+" from "+currentRoomName)
+}
@@ -0,0 +1,164 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+const (
+	// heartbeatInterval is how often we tell the server we are still connected
+	heartbeatInterval = 30 * time.Second
+	// awayAfter is how long without typing before we report ourselves away
+	awayAfter = 5 * time.Minute
+)
+
+var (
+	memberPane    *tview.TextView        // Member list beside the chat display
+	paneMembers   map[string]*roomMember // Members shown in memberPane, by username
+	lastInputAt   time.Time              // When we last typed anything
+	reportedAway  bool                   // Whether our last heartbeat said we are away
+	presenceOrder = map[string]int{"online": 0, "away": 1, "offline": 2}
+)
+
+// newMemberPane creates the member list shown beside the chat display and
+// fills it with the members of the room
+func newMemberPane(roomID string) *tview.TextView {
+	memberPane = tview.NewTextView().SetDynamicColors(true)
+	memberPane.SetBorder(true).SetTitle(" Members ")
+	paneMembers = make(map[string]*roomMember)
+	loadMemberPane(roomID)
+	return memberPane
+}
+
+// loadMemberPane reloads the member list of a room. A failure leaves the
+// list as it was; it is only a convenience.
+func loadMemberPane(roomID string) {
+	members, err := fetchMembers(roomID)
+	if err != nil {
+		return
+	}
+
+	paneMembers = make(map[string]*roomMember, len(members))
+	for i := range members {
+		paneMembers[members[i].UserID] = &members[i]
+	}
+	renderMemberPane()
+}
+
+// applyPresence updates a member's status after a presence_changed event
+func applyPresence(event wsEvent) {
+	if memberPane == nil || event.RoomID != currentRoomID {
+		return
+	}
+
+	member, ok := paneMembers[event.Username]
+	if !ok {
+		// Someone joined since the list was loaded
+		loadMemberPane(currentRoomID)
+		return
+	}
+	member.Status = event.Status
+	member.LastSeen = event.LastSeen
+	renderMemberPane()
+}
+
+// renderMemberPane shows online members first, then away and offline ones
+func renderMemberPane() {
+	members := make([]*roomMember, 0, len(paneMembers))
+	for _, member := range paneMembers {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if presenceOrder[members[i].Status] != presenceOrder[members[j].Status] {
+			return presenceOrder[members[i].Status] < presenceOrder[members[j].Status]
+		}
+		return members[i].UserID < members[j].UserID
+	})
+
+	var text strings.Builder
+	online := 0
+	for _, member := range members {
+		switch member.Status {
+		case "online":
+			online++
+			text.WriteString("[green]●[-] ")
+		case "away":
+			text.WriteString("[yellow]●[-] ")
+		default:
+			text.WriteString("[gray]○[-] ")
+		}
+		text.WriteString(tview.Escape(member.UserID))
+		if member.Role != "member" {
+			text.WriteString(" [gray](" + member.Role + ")[-]")
+		}
+		text.WriteString("\n")
+		if member.Status == "offline" && member.LastSeen != nil {
+			text.WriteString("  [gray]seen " + formatLastSeen(*member.LastSeen) + "[-]\n")
+		}
+	}
+
+	memberPane.SetTitle(fmt.Sprintf(" Members (%d online) ", online))
+	memberPane.SetText(text.String())
+}
+
+// formatLastSeen describes how long ago a member was last seen
+func formatLastSeen(at time.Time) string {
+	ago := time.Since(at)
+	switch {
+	case ago < time.Minute:
+		return "just now"
+	case ago < time.Hour:
+		return fmt.Sprintf("%dm ago", int(ago.Minutes()))
+	case ago < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(ago.Hours()))
+	default:
+		return at.Local().Format("Jan 2")
+	}
+}
+
+// noteActivity records that we are at the keyboard, telling the server right
+// away if it last heard we were away
+func noteActivity() {
+	lastInputAt = time.Now()
+	if reportedAway {
+		sendHeartbeat()
+	}
+}
+
+// startHeartbeat sends a heartbeat on the UI goroutine every heartbeatInterval
+// until stop is closed
+func startHeartbeat(stop chan struct{}) {
+	lastInputAt = time.Now()
+	reportedAway = false
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				app.QueueUpdate(sendHeartbeat)
+			}
+		}
+	}()
+}
+
+// sendHeartbeat tells the server we are connected, and whether we are away
+func sendHeartbeat() {
+	if wsConn == nil {
+		return
+	}
+	away := time.Since(lastInputAt) > awayAfter
+	status := "online"
+	if away {
+		status = "away"
+	}
+	if wsConn.WriteJSON(map[string]string{"type": "heartbeat", "status": status}) == nil {
+		reportedAway = away
+	}
+}
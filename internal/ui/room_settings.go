@@ -0,0 +1,159 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c0sm0thecoder/cli-chat-app/internal/models"
+	"github.com/rivo/tview"
+)
+
+// roomTitle is the chat view title of a room: its name, topic, code and
+// whether it is archived
+func roomTitle(name, topic, code string, archived bool) string {
+	title := " Room: " + tview.Escape(name)
+	if topic != "" {
+		title += " - " + tview.Escape(topic)
+	}
+	title += " (Code: " + code + ")"
+	if archived {
+		title += " (archived)"
+	}
+	return title + " "
+}
+
+// refreshRoomTitle redraws the chat view title from the current room's state
+func refreshRoomTitle() {
+	chatDisplay.SetTitle(roomTitle(currentRoomName, currentRoomTopic, currentRoomCode, currentRoomArchived))
+}
+
+// applyRoomUpdate refreshes the open room after a room_updated event and says
+// what another user changed
+func applyRoomUpdate(event wsEvent) {
+	if event.RoomID != currentRoomID {
+		return
+	}
+
+	var changes []string
+	if event.Name != currentRoomName {
+		changes = append(changes, "renamed the room to "+event.Name)
+	}
+	if event.Topic != currentRoomTopic {
+		if event.Topic == "" {
+			changes = append(changes, "cleared the topic")
+		} else {
+			changes = append(changes, "changed the topic to: "+event.Topic)
+		}
+	}
+	if archived := event.ArchivedAt != nil; archived != currentRoomArchived {
+		if archived {
+			changes = append(changes, "archived the room; it is now read-only")
+		} else {
+			changes = append(changes, "restored the room")
+		}
+	}
+
+	currentRoomName = event.Name
+	currentRoomTopic = event.Topic
+	currentRoomCode = event.Code
+	currentRoomArchived = event.ArchivedAt != nil
+	refreshRoomTitle()
+
+	// Our own commands already reported what they did
+	if event.UpdatedBy == username {
+		return
+	}
+	// Changes missed while disconnected come without their author
+	actor := event.UpdatedBy
+	if actor == "" {
+		actor = "Someone"
+	}
+	for _, change := range changes {
+		displayMessage("System", actor+" "+change, time.Now())
+	}
+}
+
+// handleRoomCommand runs the room settings commands: /rename <name>,
+// /topic [text], /archive and /unarchive
+func handleRoomCommand(command, args string) {
+	var room models.Room
+	switch command {
+	case "rename":
+		if args == "" {
+			showInfoModal("Error", "Usage: /rename <new room name>")
+			return
+		}
+		if err := apiCall("PATCH", "/rooms/"+currentRoomID, map[string]string{"name": args}, &room); err != nil {
+			showInfoModal("Error", "Failed to rename room: "+err.Error())
+			return
+		}
+		displayMessage("System", "Room renamed to "+room.Name, time.Now())
+	case "topic":
+		if err := apiCall("PATCH", "/rooms/"+currentRoomID, map[string]string{"topic": args}, &room); err != nil {
+			showInfoModal("Error", "Failed to change topic: "+err.Error())
+			return
+		}
+		if room.Topic == "" {
+			displayMessage("System", "Topic cleared", time.Now())
+		} else {
+			displayMessage("System", "Topic set to: "+room.Topic, time.Now())
+		}
+	case "archive", "unarchive":
+		archived := command == "archive"
+		if err := apiCall("PUT", "/rooms/"+currentRoomID+"/archived", map[string]bool{"archived": archived}, &room); err != nil {
+			showInfoModal("Error", "Failed to update room: "+err.Error())
+			return
+		}
+		if archived {
+			displayMessage("System", "The room is archived; its history stays readable but nothing new can be posted", time.Now())
+		} else {
+			displayMessage("System", "The room is active again", time.Now())
+		}
+	}
+
+	currentRoomName = room.Name
+	currentRoomTopic = room.Topic
+	currentRoomCode = room.Code
+	currentRoomArchived = room.ArchivedAt != nil
+	refreshRoomTitle()
+}
+
+// showArchivedRoomsPage lists our archived rooms, whose history can still be read
+func showArchivedRoomsPage() {
+	var rooms []roomSummary
+	if err := apiCall("GET", "/rooms?archived=true", nil, &rooms); err != nil {
+		showInfoModal("Error", "Failed to load archived rooms: "+err.Error())
+		return
+	}
+	if len(rooms) == 0 {
+		showInfoModal("Archived Rooms", "None of your rooms are archived")
+		return
+	}
+
+	list := tview.NewList().ShowSecondaryText(true)
+	list.SetBorder(true).
+		SetTitle(" Archived Rooms ").
+		SetTitleAlign(tview.AlignCenter)
+
+	for _, summary := range rooms {
+		secondary := "No messages"
+		if summary.LastMessageAt != nil {
+			secondary = "Last message " + formatRoomActivity(*summary.LastMessageAt)
+		}
+		room := &models.Room{ID: summary.ID, Name: summary.Name, Topic: summary.Topic, Code: summary.Code, ArchivedAt: summary.ArchivedAt}
+		list.AddItem(tview.Escape(summary.Name), fmt.Sprintf("%s  (Code: %s)", secondary, summary.Code), 0, func() {
+			pages.RemovePage("archived")
+			setupChatRoom(room)
+			pages.SwitchToPage("chat")
+		})
+	}
+
+	pages.AddPage("archived", list, true, false)
+	pages.SwitchToPage("archived")
+}
+
+// closeArchivedRooms leaves the archived rooms page for the rooms page
+func closeArchivedRooms() {
+	pages.RemovePage("archived")
+	showRoomsPage()
+}
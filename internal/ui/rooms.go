@@ -0,0 +1,111 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// roomSummary is one of our rooms with its latest message, as returned by the API
+type roomSummary struct {
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	Topic             string     `json:"topic"`
+	Code              string     `json:"code"`
+	Kind              string     `json:"kind"`
+	Role              string     `json:"role"`
+	Peer              *string    `json:"peer"`
+	ArchivedAt        *time.Time `json:"archived_at"`
+	LastMessageSender *string    `json:"last_message_sender"`
+	LastMessage       *string    `json:"last_message"`
+	LastMessageAt     *time.Time `json:"last_message_at"`
+}
+
+var (
+	roomsList        *tview.List // Actions followed by our rooms
+	roomsActionCount int         // Number of fixed actions at the top of roomsList
+)
+
+// showRoomsPage switches to the rooms page with a fresh list of our rooms
+func showRoomsPage() {
+	refreshRoomsList()
+	pages.SwitchToPage("rooms")
+}
+
+// refreshRoomsList lists our rooms below the actions, most recently active
+// first, with unread badges. The first nine rooms get the shortcuts 1-9.
+func refreshRoomsList() {
+	if roomsList == nil {
+		return
+	}
+	for roomsList.GetItemCount() > roomsActionCount {
+		roomsList.RemoveItem(roomsList.GetItemCount() - 1)
+	}
+
+	rooms, err := fetchRooms()
+	if err != nil {
+		roomsList.AddItem("[red]Failed to load your rooms", err.Error(), 0, nil)
+		return
+	}
+
+	// Unread counts are only decoration, so the list is still shown without them
+	unread := make(map[string]int)
+	if counts, err := fetchUnreadCounts(); err == nil {
+		for _, count := range counts {
+			unread[count.RoomID] = count.UnreadCount
+		}
+	}
+
+	for i, room := range rooms {
+		mainText := "# " + tview.Escape(room.Name)
+		if count := unread[room.ID]; count > 0 {
+			mainText += fmt.Sprintf(" [black:yellow] %d [-:-]", count)
+		}
+
+		secondary := "No messages yet"
+		if room.LastMessage != nil && room.LastMessageSender != nil && room.LastMessageAt != nil {
+			secondary = fmt.Sprintf("%s  %s: %s", formatRoomActivity(*room.LastMessageAt),
+				tview.Escape(*room.LastMessageSender), tview.Escape(*room.LastMessage))
+		}
+
+		var shortcut rune
+		if i < 9 {
+			shortcut = rune('1' + i)
+		}
+		roomsList.AddItem(mainText, secondary, shortcut, func() {
+			joinRoom(room.Code)
+		})
+	}
+}
+
+// formatRoomActivity shows the time of a room's latest message, with the date
+// when it is not from today
+func formatRoomActivity(t time.Time) string {
+	t = t.Local()
+	if t.Format("2006-01-02") == time.Now().Format("2006-01-02") {
+		return t.Format("15:04")
+	}
+	return t.Format("Jan 2")
+}
+
+// fetchRooms retrieves the rooms we have created or joined
+func fetchRooms() ([]roomSummary, error) {
+	resp, err := apiRequest("GET", "/rooms", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var rooms []roomSummary
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return rooms, nil
+}
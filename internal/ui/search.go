@@ -0,0 +1,225 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// searchHit is a message matching a search, as returned by the API
+type searchHit struct {
+	apiMessage
+	RoomName string `json:"room_name"`
+	RoomCode string `json:"room_code"`
+}
+
+// searchReturnPage is the page ESC returns to from the search page
+var searchReturnPage string
+
+// showSearchPage opens the message search screen, optionally running a query right away
+func showSearchPage(query string) {
+	searchReturnPage = "rooms"
+	if name, _ := pages.GetFrontPage(); name == "chat" {
+		searchReturnPage = "chat"
+	}
+
+	results := tview.NewList().ShowSecondaryText(true)
+	results.SetBorder(true).SetTitle(" Results ")
+
+	form := tview.NewForm()
+	form.AddInputField("Query", query, 40, nil, nil)
+	form.AddInputField("Sender", "", 20, nil, nil)
+	form.AddInputField("From (YYYY-MM-DD)", "", 12, nil, nil)
+	form.AddInputField("To (YYYY-MM-DD)", "", 12, nil, nil)
+	form.AddCheckbox("Current room only", false, nil)
+
+	runSearch := func() {
+		params := url.Values{}
+		params.Set("q", form.GetFormItem(0).(*tview.InputField).GetText())
+		if sender := form.GetFormItem(1).(*tview.InputField).GetText(); sender != "" {
+			params.Set("sender", sender)
+		}
+		if from := form.GetFormItem(2).(*tview.InputField).GetText(); from != "" {
+			params.Set("from", from)
+		}
+		if to := form.GetFormItem(3).(*tview.InputField).GetText(); to != "" {
+			params.Set("to", to)
+		}
+		if form.GetFormItem(4).(*tview.Checkbox).IsChecked() && currentRoomID != "" {
+			params.Set("room_id", currentRoomID)
+		}
+
+		hits, err := searchMessages(params)
+		if err != nil {
+			showInfoModal("Error", "Search failed: "+err.Error())
+			return
+		}
+		showSearchResults(results, hits)
+		app.SetFocus(results)
+	}
+
+	form.AddButton("Search", runSearch)
+	form.AddButton("Back", closeSearch)
+	form.SetBorder(true).
+		SetTitle(" Search Messages ").
+		SetTitleAlign(tview.AlignCenter)
+
+	searchFlex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(form, 13, 1, true).
+		AddItem(results, 0, 1, false)
+
+	pages.AddPage("search", searchFlex, true, false)
+	pages.SwitchToPage("search")
+
+	if strings.TrimSpace(query) != "" {
+		runSearch()
+	}
+}
+
+// showSearchResults lists search hits; selecting one jumps to the message
+func showSearchResults(results *tview.List, hits []searchHit) {
+	results.Clear()
+	if len(hits) == 0 {
+		results.AddItem("No messages found", "", 0, nil)
+		return
+	}
+
+	for _, hit := range hits {
+		mainText := fmt.Sprintf("[%s] %s: %s", tview.Escape(hit.RoomName), tview.Escape(hit.SenderID), tview.Escape(hit.Content))
+		secondary := hit.CreatedAt.Local().Format("2006-01-02 15:04:05")
+		results.AddItem(mainText, secondary, 0, func() {
+			pages.RemovePage("search")
+			jumpToMessage(hit.RoomID, hit.RoomCode, hit.ID, hit.ParentID)
+		})
+	}
+}
+
+// closeSearch leaves the search page
+func closeSearch() {
+	pages.RemovePage("search")
+	if searchReturnPage == "chat" && pages.HasPage("chat") {
+		pages.SwitchToPage("chat")
+	} else {
+		showRoomsPage()
+	}
+}
+
+// jumpToMessage opens the room of a message and highlights the message
+func jumpToMessage(roomID, roomCode, messageID string, parentID *string) {
+	if roomID != currentRoomID || !pages.HasPage("chat") {
+		joinRoom(roomCode)
+		if currentRoomID != roomID {
+			return
+		}
+	} else {
+		pages.SwitchToPage("chat")
+	}
+
+	// Replies live in their thread rather than the main timeline
+	if parentID != nil {
+		openThread(&chatMessage{ID: *parentID})
+		if threadView != nil {
+			threadView.selectMessage(messageID)
+		}
+		return
+	}
+	revealMessage(messageID)
+}
+
+// revealMessage highlights a message of the room's timeline. A message older
+// than the loaded history is fetched with the page around it, in the
+// background. When that page reaches the loaded messages it joins the
+// timeline; otherwise it is shown on a page of its own.
+func revealMessage(messageID string) {
+	if chatView.find(messageID) != nil || !hasOlder {
+		chatView.selectMessage(messageID)
+		return
+	}
+
+	roomID := currentRoomID
+	go func() {
+		page, err := fetchMessagesAround(roomID, messageID)
+		app.QueueUpdateDraw(func() {
+			if roomID != currentRoomID {
+				return
+			}
+			if err != nil {
+				showInfoModal("Error", "Failed to load the message: "+err.Error())
+				return
+			}
+			// Older history may have loaded in the meantime
+			if chatView.find(messageID) != nil {
+				chatView.selectMessage(messageID)
+				return
+			}
+
+			window := page.chatMessages()
+			older := window
+			for i, msg := range window {
+				if chatView.find(msg.ID) != nil {
+					older = window[:i]
+					break
+				}
+			}
+			if len(older) == len(window) && page.NewerCursor != "" {
+				showMessageContext(window, messageID)
+				return
+			}
+
+			olderCursor = page.NextCursor
+			hasOlder = page.HasMore
+			chatView.prepend(older)
+			chatView.selectMessage(messageID)
+		})
+	}()
+}
+
+// showMessageContext shows messages around a search hit that is too far back
+// to join the loaded timeline
+func showMessageContext(messages []*chatMessage, messageID string) {
+	display := tview.NewTextView().
+		SetChangedFunc(func() {
+			app.Draw()
+		})
+	display.SetBorder(true).SetTitle(" Earlier in the room (ESC to return to the room) ")
+
+	contextView := newMessageView(display)
+	for _, msg := range messages {
+		contextView.add(msg)
+	}
+	display.SetInputCapture(selectionKeys(func() *messageView { return contextView }))
+
+	pages.AddPage("context", display, true, false)
+	pages.SwitchToPage("context")
+	contextView.selectMessage(messageID)
+}
+
+// closeMessageContext returns from the messages around a search hit to the room
+func closeMessageContext() {
+	pages.RemovePage("context")
+	pages.SwitchToPage("chat")
+}
+
+// searchMessages runs a search with the given query parameters
+func searchMessages(params url.Values) ([]searchHit, error) {
+	resp, err := apiRequest("GET", "/search/messages?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var hits []searchHit
+	if err := json.NewDecoder(resp.Body).Decode(&hits); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return hits, nil
+}
@@ -0,0 +1,115 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errSessionExpired means the refresh token was rejected and we have to log
+// in again
+var errSessionExpired = errors.New("session expired, please log in again")
+
+var (
+	refreshToken string     // Exchanged for a new access token when the current one expires
+	tokenMu      sync.Mutex // Guards authToken and refreshToken; the WebSocket goroutine reads them too
+	refreshMu    sync.Mutex // Lets only one refresh run at a time
+)
+
+// tokenPair is the server's answer to a login or a refresh
+type tokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// currentToken returns the access token to send with requests
+func currentToken() string {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	return authToken
+}
+
+// setSession stores the tokens of a login or a refresh
+func setSession(pair tokenPair) {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	authToken = pair.AccessToken
+	refreshToken = pair.RefreshToken
+}
+
+// clearSession forgets our tokens
+func clearSession() {
+	setSession(tokenPair{})
+}
+
+// refreshSession exchanges the refresh token for new tokens after stale was
+// rejected. When several requests fail at once only the first refreshes;
+// the others find the token already replaced.
+func refreshSession(stale string) error {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+
+	tokenMu.Lock()
+	current, refresh := authToken, refreshToken
+	tokenMu.Unlock()
+	if current != stale {
+		return nil
+	}
+	if refresh == "" {
+		return errSessionExpired
+	}
+
+	var pair tokenPair
+	if err := postTokens("/token/refresh", refresh, &pair); err != nil {
+		return err
+	}
+	setSession(pair)
+	return nil
+}
+
+// logout revokes our refresh token on the server, ending this login, and
+// forgets our tokens. The server may be unreachable; we log out locally anyway.
+func logout() {
+	tokenMu.Lock()
+	refresh := refreshToken
+	tokenMu.Unlock()
+
+	if refresh != "" {
+		postTokens("/logout", refresh, nil)
+	}
+	clearSession()
+}
+
+// postTokens sends a refresh token to an auth endpoint and decodes the new
+// tokens into result, if given
+func postTokens(path, refresh string, result *tokenPair) error {
+	jsonData, err := json.Marshal(map[string]string{"refresh_token": refresh})
+	if err != nil {
+		return fmt.Errorf("failed to prepare request: %v", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(apiBaseURL+path, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("connection error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errSessionExpired
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return apiError(resp)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package ui
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// sessionItem is a login of our account on some device, as returned by the API
+type sessionItem struct {
+	ID            string    `json:"id"`
+	DeviceLabel   string    `json:"device_label"`
+	ClientVersion string    `json:"client_version"`
+	IPAddress     string    `json:"ip_address"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastUsedAt    time.Time `json:"last_used_at"`
+	Current       bool      `json:"current"`
+}
+
+// deviceLabel names this device in the sessions list
+func deviceLabel() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "Terminal client"
+	}
+	return "Terminal client on " + host
+}
+
+// clientVersion is the version of this client, as recorded by the build
+func clientVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// showSessionsPage lists the devices logged in to our account; selecting one
+// offers to log it out
+func showSessionsPage() {
+	var sessions []sessionItem
+	if err := apiCall("GET", "/sessions", nil, &sessions); err != nil {
+		showInfoModal("Error", "Failed to load sessions: "+err.Error())
+		return
+	}
+
+	list := tview.NewList().ShowSecondaryText(true)
+	list.SetBorder(true).
+		SetTitle(" Sessions ").
+		SetTitleAlign(tview.AlignCenter)
+
+	for _, session := range sessions {
+		mainText := tview.Escape(session.DeviceLabel)
+		if mainText == "" {
+			mainText = "Unknown device"
+		}
+		if session.Current {
+			mainText += " [green](this device)[-]"
+		}
+		secondary := fmt.Sprintf("%s from %s, last used %s", session.ClientVersion, session.IPAddress, session.LastUsedAt.Local().Format("2006-01-02 15:04"))
+		list.AddItem(mainText, tview.Escape(secondary), 0, func() {
+			if session.Current {
+				showInfoModal("Sessions", "This is the session you are using; use Logout to end it")
+				return
+			}
+			confirmRevokeSession(session)
+		})
+	}
+
+	pages.AddPage("sessions", list, true, false)
+	pages.SwitchToPage("sessions")
+}
+
+// confirmRevokeSession asks before logging another device out
+func confirmRevokeSession(session sessionItem) {
+	modal := tview.NewModal().
+		SetText("Log out " + session.DeviceLabel + "?").
+		AddButtons([]string{"Log out", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			pages.RemovePage("modal")
+			if buttonLabel != "Log out" {
+				return
+			}
+			if err := apiCall("DELETE", "/sessions/"+url.PathEscape(session.ID), nil, nil); err != nil {
+				showInfoModal("Error", "Failed to log the session out: "+err.Error())
+				return
+			}
+			pages.RemovePage("sessions")
+			showSessionsPage()
+		})
+
+	modal.SetBorder(true).
+		SetTitle(" Sessions ").
+		SetTitleAlign(tview.AlignCenter)
+
+	pages.AddPage("modal", modal, false, true)
+}
+
+// closeSessions leaves the sessions page for the rooms page
+func closeSessions() {
+	pages.RemovePage("sessions")
+	showRoomsPage()
+}
+
+// endRevokedSession returns to the login page after our session was logged
+// out from another device
+func endRevokedSession() {
+	closeWebSocket()
+	clearSession()
+	username = ""
+	currentRoomID = ""
+	pages.RemovePage("thread")
+	pages.SwitchToPage("login")
+	showInfoModal("Logged out", "This session was logged out from another device")
+}
@@ -0,0 +1,99 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// threadParentID is the ID of the message whose thread is open
+var threadParentID string
+
+// openThread shows a message and its replies on the thread page
+func openThread(msg *chatMessage) {
+	parent, replies, err := fetchThread(currentRoomID, msg.ID)
+	if err != nil {
+		showInfoModal("Error", "Failed to load thread: "+err.Error())
+		return
+	}
+
+	// Setup thread display
+	display := tview.NewTextView().
+		SetChangedFunc(func() {
+			app.Draw()
+		})
+	display.SetBorder(true).SetTitle(" Thread (ESC to return to the room) ")
+
+	threadView = newMessageView(display)
+	threadParentID = parent.ID
+	threadView.add(parent)
+	for _, reply := range replies {
+		threadView.add(reply)
+	}
+
+	// Create reply input field
+	replyInput := tview.NewInputField().
+		SetLabel("Reply: ").
+		SetFieldWidth(0)
+	replyInput.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			content := replyInput.GetText()
+			if strings.HasPrefix(content, "/") {
+				handleCommand(threadView, content)
+				replyInput.SetText("")
+			} else if content != "" {
+				sendMessage(currentRoomID, threadParentID, content)
+				replyInput.SetText("")
+			}
+		}
+	})
+	replyInput.SetInputCapture(selectionKeys(func() *messageView { return threadView }))
+
+	// Create layout
+	threadFlex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(display, 0, 1, false).
+		AddItem(replyInput, 3, 1, true)
+
+	pages.AddPage("thread", threadFlex, true, false)
+	pages.SwitchToPage("thread")
+}
+
+// closeThread returns from the thread page to the room
+func closeThread() {
+	threadView = nil
+	threadParentID = ""
+	pages.RemovePage("thread")
+	pages.SwitchToPage("chat")
+}
+
+// fetchThread gets a message and its replies
+func fetchThread(roomID, messageID string) (*chatMessage, []*chatMessage, error) {
+	resp, err := apiRequest("GET", fmt.Sprintf("/rooms/%s/messages/%s/thread", roomID, messageID), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, apiError(resp)
+	}
+
+	var thread struct {
+		Parent  apiMessage   `json:"parent"`
+		Replies []apiMessage `json:"replies"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&thread); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	replies := make([]*chatMessage, len(thread.Replies))
+	for i, reply := range thread.Replies {
+		replies[i] = reply.toChatMessage()
+	}
+	return thread.Parent.toChatMessage(), replies, nil
+}
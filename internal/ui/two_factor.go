@@ -0,0 +1,204 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/skip2/go-qrcode"
+)
+
+// twoFactorStatus tells whether our account has two-factor authentication on
+type twoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// totpEnrollment is a new authenticator secret, as returned by the API
+type totpEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// showTwoFactorLoginForm asks for the second factor of a login
+func showTwoFactorLoginForm(name, challenge string) {
+	form := tview.NewForm()
+	form.AddTextView("", "Enter the code from your authenticator app, or one of your recovery codes.", 40, 2, true, false)
+	form.AddInputField("Code", "", 20, nil, nil)
+	form.AddButton("Verify", func() {
+		code := strings.TrimSpace(form.GetFormItem(1).(*tview.InputField).GetText())
+		if code == "" {
+			showInfoModal("Error", "Code cannot be empty")
+			return
+		}
+
+		pair, err := completeLogin(challenge, code)
+		if err != nil {
+			showInfoModal("Login Failed", err.Error())
+			return
+		}
+		pages.RemovePage("accountForm")
+		finishLogin(name, *pair)
+	})
+	form.AddButton("Cancel", func() {
+		pages.RemovePage("accountForm")
+	})
+
+	showAccountForm(form, " Two-Factor Authentication ", 11)
+}
+
+// completeLogin sends the second factor of a login and returns the tokens of
+// the new session
+func completeLogin(challenge, code string) (*tokenPair, error) {
+	jsonData, err := json.Marshal(map[string]string{"challenge": challenge, "code": code})
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request: %v", err)
+	}
+
+	resp, err := sendAPIRequest("POST", "/login/2fa", jsonData, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// The server tells a wrong code from a login that has to start over
+	if resp.StatusCode == http.StatusUnauthorized {
+		message, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s", strings.TrimSpace(string(message)))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var pair tokenPair
+	if err := json.NewDecoder(resp.Body).Decode(&pair); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	if pair.AccessToken == "" || pair.RefreshToken == "" {
+		return nil, fmt.Errorf("no token received from server")
+	}
+	return &pair, nil
+}
+
+// showTwoFactorSettings offers to turn two-factor authentication on or off,
+// depending on whether it is on
+func showTwoFactorSettings() {
+	var status twoFactorStatus
+	if err := apiCall("GET", "/account/2fa", nil, &status); err != nil {
+		showInfoModal("Error", "Failed to load two-factor status: "+err.Error())
+		return
+	}
+
+	if status.Enabled {
+		showDisableTwoFactorForm(status.RecoveryCodesLeft)
+		return
+	}
+	showEnableTwoFactorPage()
+}
+
+// showEnableTwoFactorPage shows a new authenticator secret as a QR code and
+// asks for a code to confirm the authenticator was set up
+func showEnableTwoFactorPage() {
+	var enrollment totpEnrollment
+	if err := apiCall("POST", "/account/2fa", nil, &enrollment); err != nil {
+		showInfoModal("Error", "Failed to set up two-factor authentication: "+err.Error())
+		return
+	}
+
+	qr, err := qrcode.New(enrollment.ProvisioningURI, qrcode.Low)
+	if err != nil {
+		showInfoModal("Error", "Failed to draw QR code: "+err.Error())
+		return
+	}
+	// Dark modules are left blank, which scans right on dark terminals
+	image := qr.ToSmallString(false)
+	imageLines := strings.Count(image, "\n")
+	imageWidth := len([]rune(strings.SplitN(image, "\n", 2)[0]))
+
+	qrView := tview.NewTextView().
+		SetText(image).
+		SetTextAlign(tview.AlignCenter)
+
+	form := tview.NewForm()
+	form.AddTextView("Secret", enrollment.Secret, 40, 1, true, false)
+	form.AddInputField("Code", "", 20, nil, nil)
+	form.AddButton("Enable", func() {
+		code := strings.TrimSpace(form.GetFormItem(1).(*tview.InputField).GetText())
+		if code == "" {
+			showInfoModal("Error", "Code cannot be empty")
+			return
+		}
+
+		var result struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+		if err := apiCall("POST", "/account/2fa/verify", map[string]string{"code": code}, &result); err != nil {
+			showInfoModal("Error", "Failed to enable two-factor authentication: "+err.Error())
+			return
+		}
+		pages.RemovePage("accountForm")
+		showRecoveryCodes(result.RecoveryCodes)
+	})
+	form.AddButton("Cancel", func() {
+		pages.RemovePage("accountForm")
+	})
+
+	layout := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(tview.NewTextView().SetText("Scan the code with your authenticator app, or type in the secret."), 1, 0, false).
+		AddItem(qrView, imageLines, 0, false).
+		AddItem(form, 7, 0, true)
+	layout.SetBorder(true).
+		SetTitle(" Enable Two-Factor Authentication ").
+		SetTitleAlign(tview.AlignCenter)
+
+	width := imageWidth + 4
+	if width < 70 {
+		width = 70
+	}
+	pages.AddPage("accountForm", tview.NewGrid().
+		SetColumns(0, width, 0).
+		SetRows(0, imageLines+10, 0).
+		AddItem(layout, 1, 1, 1, 1, 0, 0, true), true, true)
+}
+
+// showRecoveryCodes shows the recovery codes of a newly enabled
+// authenticator. The server does not show them again.
+func showRecoveryCodes(codes []string) {
+	showInfoModal("Two-Factor Authentication Enabled",
+		"Save these recovery codes. Each one logs you in once if you lose your authenticator:\n\n"+
+			strings.Join(codes, "\n"))
+}
+
+// showDisableTwoFactorForm asks for the password and a code before turning
+// two-factor authentication off
+func showDisableTwoFactorForm(recoveryCodesLeft int) {
+	form := tview.NewForm()
+	form.AddTextView("", fmt.Sprintf("Two-factor authentication is on. You have %d recovery codes left.", recoveryCodesLeft), 40, 2, true, false)
+	form.AddPasswordField("Password", "", 30, '*', nil)
+	form.AddInputField("Code", "", 20, nil, nil)
+	form.AddButton("Disable", func() {
+		password := form.GetFormItem(1).(*tview.InputField).GetText()
+		code := strings.TrimSpace(form.GetFormItem(2).(*tview.InputField).GetText())
+		if password == "" || code == "" {
+			showInfoModal("Error", "Password and code cannot be empty")
+			return
+		}
+
+		body := map[string]string{"password": password, "code": code}
+		if err := apiCall("DELETE", "/account/2fa", body, nil); err != nil {
+			showInfoModal("Error", "Failed to disable two-factor authentication: "+err.Error())
+			return
+		}
+		pages.RemovePage("accountForm")
+		showInfoModal("Two-Factor Authentication Disabled", "Logging in now takes only your password")
+	})
+	form.AddButton("Cancel", func() {
+		pages.RemovePage("accountForm")
+	})
+
+	showAccountForm(form, " Two-Factor Authentication ", 13)
+}
@@ -0,0 +1,107 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+const (
+	// typingRefresh is how often typing_started is repeated while we keep typing
+	typingRefresh = 3 * time.Second
+	// typingTimeout hides another user's indicator when no new event arrives
+	typingTimeout = 6 * time.Second
+)
+
+var (
+	typingIndicator *tview.TextView      // Line under the chat display
+	typingUsers     map[string]time.Time // When each typing user's indicator expires
+	typingSentAt    time.Time            // When we last sent typing_started, zero when idle
+)
+
+// newTypingIndicator creates the line showing who is typing in the room
+func newTypingIndicator() *tview.TextView {
+	typingUsers = make(map[string]time.Time)
+	typingSentAt = time.Time{}
+	typingIndicator = tview.NewTextView().SetDynamicColors(true)
+	return typingIndicator
+}
+
+// inputChanged tells the room when we start or stop typing, sending
+// typing_started at most once per typingRefresh. Any input also keeps us online.
+func inputChanged(text string) {
+	noteActivity()
+	if text == "" {
+		if !typingSentAt.IsZero() {
+			sendTypingFrame("typing_stopped")
+			typingSentAt = time.Time{}
+		}
+		return
+	}
+
+	// Commands are not messages, so they do not count as typing
+	if text[0] == '/' || time.Since(typingSentAt) < typingRefresh {
+		return
+	}
+	if sendTypingFrame("typing_started") {
+		typingSentAt = time.Now()
+	}
+}
+
+// sendTypingFrame writes a typing frame to the WebSocket, if connected
+func sendTypingFrame(frameType string) bool {
+	if wsConn == nil {
+		return false
+	}
+	return wsConn.WriteJSON(map[string]string{"type": frameType}) == nil
+}
+
+// setTyping shows or hides a user's typing indicator
+func setTyping(user string, typing bool) {
+	if typingIndicator == nil || user == username {
+		return
+	}
+
+	if typing {
+		typingUsers[user] = time.Now().Add(typingTimeout)
+		time.AfterFunc(typingTimeout, func() {
+			app.QueueUpdateDraw(renderTyping)
+		})
+	} else {
+		delete(typingUsers, user)
+	}
+	renderTyping()
+}
+
+// renderTyping drops expired indicators and shows who is still typing
+func renderTyping() {
+	if typingIndicator == nil {
+		return
+	}
+
+	now := time.Now()
+	var users []string
+	for user, expires := range typingUsers {
+		if now.Before(expires) {
+			users = append(users, user)
+		} else {
+			delete(typingUsers, user)
+		}
+	}
+	sort.Strings(users)
+
+	var text string
+	switch len(users) {
+	case 0:
+		text = ""
+	case 1:
+		text = fmt.Sprintf("%s is typing…", tview.Escape(users[0]))
+	case 2:
+		text = fmt.Sprintf("%s and %s are typing…", tview.Escape(users[0]), tview.Escape(users[1]))
+	default:
+		text = "Several people are typing…"
+	}
+	typingIndicator.SetText("[gray::i]" + text)
+}
@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// roomUnread is one of our rooms with its unread count, as returned by the API
+type roomUnread struct {
+	RoomID      string `json:"room_id"`
+	RoomName    string `json:"room_name"`
+	RoomCode    string `json:"room_code"`
+	UnreadCount int    `json:"unread_count"`
+}
+
+// readReceipt is how far we have read in a room, as returned by the API
+type readReceipt struct {
+	LastReadMessageID string    `json:"last_read_message_id"`
+	LastReadAt        time.Time `json:"last_read_at"`
+}
+
+// insertUnreadDivider marks where the messages we have not read yet start
+func insertUnreadDivider(view *messageView, receipt *readReceipt) {
+	if receipt == nil {
+		return
+	}
+
+	for i, msg := range view.messages {
+		if msg.ID == "" || msg.SenderID == username || !msg.CreatedAt.After(receipt.LastReadAt) {
+			continue
+		}
+		divider := &chatMessage{Divider: true}
+		view.messages = append(view.messages[:i], append([]*chatMessage{divider}, view.messages[i:]...)...)
+		view.render()
+		view.display.ScrollToEnd()
+		return
+	}
+}
+
+// markRead moves our read pointer in a room up to a message in the background
+func markRead(roomID, messageID string) {
+	if roomID == "" || messageID == "" {
+		return
+	}
+	go func() {
+		resp, err := apiRequest("PUT", "/rooms/"+roomID+"/read", map[string]string{"message_id": messageID})
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+}
+
+// fetchReadReceipt returns how far we have read in a room, or nil if we never did
+func fetchReadReceipt(roomID string) (*readReceipt, error) {
+	resp, err := apiRequest("GET", "/rooms/"+roomID+"/read", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var receipt readReceipt
+	if err := json.NewDecoder(resp.Body).Decode(&receipt); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return &receipt, nil
+}
+
+// fetchUnreadCounts retrieves our rooms with their unread message counts
+func fetchUnreadCounts() ([]roomUnread, error) {
+	resp, err := apiRequest("GET", "/rooms/unread", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var rooms []roomUnread
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return rooms, nil
+}